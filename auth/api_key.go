@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiKeyPrefix     = "ak_"             // API密钥前缀，便于识别
+	apiKeyIdSize     = 32                // API密钥id长度（16字节随机数的十六进制）
+	apiKeySecretSize = 32                // API密钥密文长度
+	apiKeyClientTag  = "__x_x__api_key:" // API密钥消费者的客户端标记前缀
+)
+
+// APIKey API密钥信息，不包含密钥明文
+type APIKey struct {
+	ID        string    // 密钥id
+	Username  string    // 所属用户名
+	Name      string    // 密钥名称
+	Scopes    []string  // 授权范围（资源URI），为空时不额外限制
+	Digest    string    // 密钥摘要
+	CreatedAt time.Time // 创建时间
+	ExpiresAt time.Time // 过期时间，零值表示永不过期
+}
+
+// APIKeyStore API密钥存储
+type APIKeyStore interface {
+	// Save 保存API密钥
+	Save(key *APIKey) error
+	// Get 根据密钥id获取API密钥，不存在时应返回 ErrInvalidCredentials 类型的错误，其余错误将视为存储不可用（ErrStore）
+	Get(id string) (*APIKey, error)
+	// List 获取用户的所有API密钥
+	List(username string) ([]*APIKey, error)
+	// Delete 删除API密钥
+	Delete(id string) error
+}
+
+// WithAPIKeyStore 使用特定的API密钥存储，默认存储于内存中
+func WithAPIKeyStore(store APIKeyStore) Option {
+	return func(auth *auth) error {
+		auth.apiKeys = store
+		return nil
+	}
+}
+
+// NewMemoryAPIKeyStore 创建一个基于内存的API密钥存储
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys: map[string]*APIKey{},
+	}
+}
+
+// MemoryAPIKeyStore 基于内存的API密钥存储
+type MemoryAPIKeyStore struct {
+	sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// Save 保存API密钥
+func (slf *MemoryAPIKeyStore) Save(key *APIKey) error {
+	slf.Lock()
+	defer slf.Unlock()
+	copied := *key
+	slf.keys[key.ID] = &copied
+	return nil
+}
+
+// Get 根据密钥id获取API密钥
+func (slf *MemoryAPIKeyStore) Get(id string) (*APIKey, error) {
+	slf.RLock()
+	defer slf.RUnlock()
+	key, exist := slf.keys[id]
+	if !exist {
+		return nil, newError(ErrInvalidCredentials, "api key does not exist")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// List 获取用户的所有API密钥，按创建时间排序
+func (slf *MemoryAPIKeyStore) List(username string) ([]*APIKey, error) {
+	slf.RLock()
+	defer slf.RUnlock()
+	var keys []*APIKey
+	for _, key := range slf.keys {
+		if key.Username == username {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Delete 删除API密钥
+func (slf *MemoryAPIKeyStore) Delete(id string) error {
+	slf.Lock()
+	delete(slf.keys, id)
+	slf.Unlock()
+	return nil
+}
+
+func (slf *auth) IssueAPIKey(username string, name string, scopes []string, expire time.Duration) (string, *APIKey, error) {
+	var b = make([]byte, apiKeyIdSize/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	var secret = make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	info := &APIKey{
+		ID:        hex.EncodeToString(b),
+		Username:  username,
+		Name:      name,
+		Scopes:    scopes,
+		Digest:    apiKeyDigest(secret),
+		CreatedAt: time.Now(),
+	}
+	if expire > 0 {
+		info.ExpiresAt = info.CreatedAt.Add(expire)
+	}
+	if err := slf.apiKeys.Save(info); err != nil {
+		return "", nil, wrapError(ErrStore, err)
+	}
+	return apiKeyPrefix + encodeToken(tokenVersion1, append([]byte(info.ID), secret...)), info, nil
+}
+
+func (slf *auth) ListAPIKeys(username string) ([]*APIKey, error) {
+	keys, err := slf.apiKeys.List(username)
+	if err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	return keys, nil
+}
+
+func (slf *auth) RevokeAPIKey(username string, id string) error {
+	info, err := slf.apiKeys.Get(id)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if info.Username != username {
+		return newError(ErrInvalidCredentials, "api key does not exist")
+	}
+	return wrapError(ErrStore, slf.apiKeys.Delete(id))
+}
+
+func (slf *auth) GetConsumerWithAPIKey(key string) (Consumer, error) {
+	consumer, username, err := slf.apiKeyConsumer(key)
+	record := AuditRecord{Action: AuditActionAPIKeySucceeded, Username: username}
+	if err != nil {
+		record.Action = AuditActionAPIKeyFailed
+		record.Error = err.Error()
+		slf.audit(record)
+		return nil, err
+	}
+	record.SessionID = consumer.GetTag()
+	slf.audit(record)
+	return consumer, nil
+}
+
+// 解析API密钥并构建消费者，返回密钥所属的用户名，密钥无法解析时用户名为空
+func (slf *auth) apiKeyConsumer(key string) (Consumer, string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, "", newError(ErrInvalidCredentials, "malformed api key")
+	}
+	version, payload, err := decodeToken(strings.TrimPrefix(key, apiKeyPrefix))
+	if err != nil {
+		return nil, "", wrapError(ErrInvalidCredentials, err)
+	}
+	if version != tokenVersion1 {
+		return nil, "", newError(ErrInvalidCredentials, "unsupported api key version")
+	}
+	if len(payload) != apiKeyIdSize+apiKeySecretSize {
+		return nil, "", newError(ErrInvalidCredentials, "malformed api key")
+	}
+	info, err := slf.apiKeys.Get(string(payload[:apiKeyIdSize]))
+	if err != nil {
+		return nil, "", wrapError(ErrStore, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(info.Digest), []byte(apiKeyDigest(payload[apiKeyIdSize:]))) != 1 {
+		return nil, info.Username, newError(ErrInvalidCredentials, "invalid api key")
+	}
+	if !info.ExpiresAt.IsZero() && !time.Now().Before(info.ExpiresAt) {
+		return nil, info.Username, newError(ErrInvalidCredentials, "api key has expired")
+	}
+
+	// API密钥消费者不会创建会话，角色在每次解析时重新获取
+	consumer := newConsumer(slf, info.Username, apiKeyClientTag+info.ID)
+	consumer.setScopes(info.Scopes)
+	if err = slf.refreshRole(context.Background(), consumer, false); err != nil {
+		return nil, info.Username, err
+	}
+	return consumer, info.Username, nil
+}
+
+// API密钥摘要，存储中仅保留摘要
+func apiKeyDigest(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 不对应事件的审计动作，其余动作与 EventType.String 一致
+const (
+	// AuditActionRoleCheckChanged 通过 SetRoleCheck 更换角色设置函数
+	AuditActionRoleCheckChanged = "role_check_changed"
+	// AuditActionAPIKeySucceeded 通过 GetConsumerWithAPIKey 认证成功
+	AuditActionAPIKeySucceeded = "api_key_succeeded"
+	// AuditActionAPIKeyFailed 通过 GetConsumerWithAPIKey 认证失败，密钥可解析时记录其所属用户名
+	AuditActionAPIKeyFailed = "api_key_failed"
+)
+
+// AuditRecord 审计记录，记录之间通过哈希链防篡改
+type AuditRecord struct {
+	Seq        uint64    `json:"seq"`                   // 序号，从 1 开始连续递增
+	Time       time.Time `json:"time"`                  // 发生时间
+	Action     string    `json:"action"`                // 动作，如 login_succeeded、banned
+	Username   string    `json:"username,omitempty"`    // 用户名
+	SessionID  string    `json:"session_id,omitempty"`  // 会话id
+	IP         string    `json:"ip,omitempty"`          // 来源IP
+	ClientType string    `json:"client_type,omitempty"` // 客户端类型
+	UserAgent  string    `json:"user_agent,omitempty"`  // 客户端 User-Agent
+	Actor      string    `json:"actor,omitempty"`       // 发起操作的用户
+	Roles      []string  `json:"roles,omitempty"`       // 刷新后的角色名称
+	Error      string    `json:"error,omitempty"`       // 失败原因
+	PrevHash   string    `json:"prev_hash"`             // 上一条记录的哈希，第一条记录为空
+	Hash       string    `json:"hash"`                  // 本条记录的哈希
+}
+
+// AuditSink 审计记录的只追加存储
+//
+// Append 接收的记录尚未计算序号及哈希，实现需通过 AuditChain 串联后再持久化
+type AuditSink interface {
+	// Append 追加一条审计记录
+	Append(record AuditRecord) error
+}
+
+// WithAuditSink 将登录、退出、踢出、刷新令牌及角色变更等事件写入审计存储（可多个）
+//
+// 审计记录在操作生效后同步写入，写入失败不会影响操作结果
+func WithAuditSink(sinks ...AuditSink) Option {
+	return func(auth *auth) error {
+		auth.auditSinks = append(auth.auditSinks, sinks...)
+		return nil
+	}
+}
+
+// AuditChain 审计记录哈希链，为记录分配序号并计算哈希
+type AuditChain struct {
+	seq  uint64
+	last string
+}
+
+// NewAuditChain 创建一个从特定记录之后继续的哈希链，last 为空时从头开始
+func NewAuditChain(last *AuditRecord) *AuditChain {
+	if last == nil {
+		return &AuditChain{}
+	}
+	return &AuditChain{seq: last.Seq, last: last.Hash}
+}
+
+// Next 为记录分配下一个序号并计算哈希，非并发安全
+func (slf *AuditChain) Next(record AuditRecord) AuditRecord {
+	slf.seq++
+	record.Seq = slf.seq
+	record.PrevHash = slf.last
+	record.Hash = auditHash(record)
+	slf.last = record.Hash
+	return record
+}
+
+// VerifyAuditChain 校验审计记录的序号及哈希链是否完整，records 需为从头开始的连续记录
+func VerifyAuditChain(records []AuditRecord) error {
+	var last string
+	for i, record := range records {
+		if record.Seq != uint64(i+1) {
+			return fmt.Errorf("audit record %d: unexpected seq %d", i+1, record.Seq)
+		}
+		if record.PrevHash != last {
+			return fmt.Errorf("audit record %d: previous hash mismatch", record.Seq)
+		}
+		if auditHash(record) != record.Hash {
+			return fmt.Errorf("audit record %d: hash mismatch", record.Seq)
+		}
+		last = record.Hash
+	}
+	return nil
+}
+
+// 计算记录的哈希，即不包含 Hash 字段的 JSON 的 SHA-256
+func auditHash(record AuditRecord) string {
+	record.Hash = ""
+	record.Time = record.Time.UTC()
+	data, _ := json.Marshal(record)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditQuery 审计记录查询条件，零值字段不参与过滤
+type AuditQuery struct {
+	Action   string    // 动作
+	Username string    // 用户名
+	Actor    string    // 发起操作的用户
+	Since    time.Time // 不早于该时间
+	Until    time.Time // 早于该时间
+}
+
+// Match 检查记录是否满足查询条件
+func (slf AuditQuery) Match(record AuditRecord) bool {
+	return (slf.Action == "" || record.Action == slf.Action) &&
+		(slf.Username == "" || record.Username == slf.Username) &&
+		(slf.Actor == "" || record.Actor == slf.Actor) &&
+		(slf.Since.IsZero() || !record.Time.Before(slf.Since)) &&
+		(slf.Until.IsZero() || record.Time.Before(slf.Until))
+}
+
+// NewMemoryAuditSink 创建一个基于内存的审计存储，通常用于测试
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{chain: NewAuditChain(nil)}
+}
+
+// MemoryAuditSink 基于内存的审计存储
+type MemoryAuditSink struct {
+	sync.RWMutex
+	chain   *AuditChain
+	records []AuditRecord
+}
+
+func (slf *MemoryAuditSink) Append(record AuditRecord) error {
+	slf.Lock()
+	slf.records = append(slf.records, slf.chain.Next(record))
+	slf.Unlock()
+	return nil
+}
+
+// Records 获取所有审计记录
+func (slf *MemoryAuditSink) Records() []AuditRecord {
+	slf.RLock()
+	defer slf.RUnlock()
+	return append([]AuditRecord(nil), slf.records...)
+}
+
+// Query 获取满足查询条件的审计记录
+func (slf *MemoryAuditSink) Query(query AuditQuery) []AuditRecord {
+	slf.RLock()
+	defer slf.RUnlock()
+	var records []AuditRecord
+	for _, record := range slf.records {
+		if query.Match(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// NewFileAuditSink 创建一个以 JSON Lines 格式追加写入文件的审计存储，文件已存在时将从最后一条记录继续哈希链
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	records, err := ReadAuditFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var last *AuditRecord
+	if len(records) > 0 {
+		last = &records[len(records)-1]
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file, chain: NewAuditChain(last)}, nil
+}
+
+// FileAuditSink 以 JSON Lines 格式追加写入文件的审计存储
+type FileAuditSink struct {
+	sync.Mutex
+	file  *os.File
+	chain *AuditChain
+}
+
+func (slf *FileAuditSink) Append(record AuditRecord) error {
+	slf.Lock()
+	defer slf.Unlock()
+	record = slf.chain.Next(record)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = slf.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭审计文件
+func (slf *FileAuditSink) Close() error {
+	return slf.file.Close()
+}
+
+// ReadAuditFile 读取 JSON Lines 格式的审计文件，可配合 VerifyAuditChain 校验
+func ReadAuditFile(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// 将事件写入所有审计存储
+func (slf *auth) auditEvent(event Event) {
+	record := AuditRecord{
+		Time:       event.Time,
+		Action:     event.Type.String(),
+		Username:   event.Username,
+		SessionID:  event.SessionID,
+		IP:         event.Device.IP,
+		ClientType: event.Device.ClientType,
+		UserAgent:  event.Device.UserAgent,
+		Actor:      event.Actor,
+	}
+	for _, r := range event.Roles {
+		record.Roles = append(record.Roles, r.GetName())
+	}
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+	slf.audit(record)
+}
+
+// 写入审计记录
+func (slf *auth) audit(record AuditRecord) {
+	if len(slf.auditSinks) == 0 {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = record.Time.UTC()
+	for i, sink := range slf.auditSinks {
+		if err := sink.Append(record); err != nil {
+			slf.logger.Error("append audit record failed", "sink", i, "action", record.Action, logKeyUsername, record.Username, logKeyError, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuth_Audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryAuditSink()
+	auth, err := New(session.NewManagerMemory(), WithAuditSink(memory, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetRoleCheck(func(username string, roleHelper *RoleHelper) ([]Role, error) {
+		return []Role{roleHelper.NewRole("user")}, nil
+	})
+	auth.AddTempAccount("admin", "12345")
+
+	if _, err = auth.Login().UseSourceIP("10.0.0.1").Password("admin", "54321"); err == nil {
+		t.Fatal("expect login failed")
+	}
+	consumer, err := auth.Login().UseSourceIP("10.0.0.1").UseDevice(Device{ClientType: "web"}).Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.RefreshRole(consumer); err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.BanBy(consumer, "root"); err != nil {
+		t.Fatal(err)
+	}
+	key, info, err := auth.IssueAPIKey("admin", "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.GetConsumerWithAPIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.RevokeAPIKey("admin", info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.GetConsumerWithAPIKey(key); err == nil {
+		t.Fatal("revoked api key should be rejected")
+	}
+
+	var actions []string
+	for _, record := range memory.Records() {
+		actions = append(actions, record.Action)
+	}
+	if strings.Join(actions, ",") != "role_check_changed,login_failed,login_succeeded,roles_refreshed,banned,api_key_succeeded,api_key_failed" {
+		t.Fatal("unexpected actions", actions)
+	}
+	if records := memory.Query(AuditQuery{Action: "login_failed", Username: "admin"}); len(records) != 1 || records[0].IP != "10.0.0.1" || records[0].Error == "" {
+		t.Fatal("unexpected login failed records", records)
+	}
+	if records := memory.Query(AuditQuery{Actor: "root"}); len(records) != 1 || records[0].Action != "banned" || records[0].SessionID != consumer.GetTag() {
+		t.Fatal("unexpected banned records", records)
+	}
+	if records := memory.Query(AuditQuery{Actor: ActorSystem}); len(records) != 1 || records[0].Action != AuditActionRoleCheckChanged {
+		t.Fatal("unexpected system records", records)
+	}
+	if records := memory.Query(AuditQuery{Action: AuditActionAPIKeyFailed}); len(records) != 1 || records[0].Error == "" {
+		t.Fatal("unexpected api key failed records", records)
+	}
+	if records := memory.Query(AuditQuery{Action: "roles_refreshed"}); len(records) != 1 || strings.Join(records[0].Roles, ",") != "user" {
+		t.Fatal("unexpected roles refreshed records", records)
+	}
+	if err = VerifyAuditChain(memory.Records()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开文件后继续哈希链
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if file, err = NewFileAuditSink(path); err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Append(AuditRecord{Action: "custom"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+	records, err := ReadAuditFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 8 {
+		t.Fatal("expect 8 records, got", len(records))
+	}
+	if err = VerifyAuditChain(records); err != nil {
+		t.Fatal(err)
+	}
+
+	// 篡改记录
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, []byte(strings.Replace(string(data), `"actor":"root"`, `"actor":"admin"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = ReadAuditFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAuditChain(records); err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatal("expect hash mismatch, got", err)
+	}
+}
+
+func TestAuth_AuditRejectedLogin(t *testing.T) {
+	memory := NewMemoryAuditSink()
+	auth, err := New(session.NewManagerMemory(), WithAuditSink(memory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	auth.Hook(func(ctx context.Context, event Event) error {
+		return errors.New("maintenance")
+	}, EventLoginSucceeded)
+
+	// 凭证正确但被钩子拒绝的登录同样留下失败记录
+	if _, err = auth.Login().UseSourceIP("10.0.0.1").Password("admin", "12345"); !errors.Is(err, ErrVetoed) {
+		t.Fatal("expect vetoed, got", err)
+	}
+	records := memory.Query(AuditQuery{Action: "login_failed", Username: "admin"})
+	if len(records) != 1 || records[0].IP != "10.0.0.1" || !strings.Contains(records[0].Error, "maintenance") {
+		t.Fatal("unexpected login failed records", records)
+	}
+	if records = memory.Query(AuditQuery{Action: "login_succeeded"}); len(records) != 0 {
+		t.Fatal("rejected login should not be recorded as succeeded", records)
+	}
+}
@@ -1,10 +1,10 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/kercylan98/go-session/session"
-	"github.com/kercylan98/klib/cipher"
 	"sync"
 	"time"
 )
@@ -12,79 +12,223 @@ import (
 type Auth interface {
 	// Login 消费者登录
 	Login() LoginModeSelector
+	// LoginContext 消费者登录，ctx 将传递至验证器及角色设置函数，并在访问会话管理器前检查是否已取消
+	LoginContext(ctx context.Context) LoginModeSelector
 	// IsLogin 检查消费者是否登录
 	IsLogin(consumer Consumer) bool
-	// IsLoginWithToken 根据token检查消费者是否登录
+	// IsLoginWithToken 根据token检查消费者是否登录，与 GetConsumerWithToken 相同会更新最后活跃时间
 	IsLoginWithToken(token string) bool
 	// GetConsumer 获取消费者
 	GetConsumer(tag string) (Consumer, error)
 	// GetConsumerWithToken 通过Token获取消费者
+	//
+	// 该方法并非只读：会将消费者的最后活跃时间（Device.LastSeenAt）写入会话管理器，
+	// 同一会话每分钟最多写入一次，写入失败不影响返回结果。仅需读取消费者时应使用 GetConsumer
 	GetConsumerWithToken(token string) (Consumer, error)
+	// GetConsumerWithTokenContext 通过Token获取消费者，ctx 取消或超时时返回 ctx.Err()，副作用同 GetConsumerWithToken
+	GetConsumerWithTokenContext(ctx context.Context, token string) (Consumer, error)
+	// ParseToken 离线解析并校验Token，不会访问会话管理器
+	ParseToken(token string) (*Claims, error)
+	// RotateKeys 从密钥提供者加载新的密钥用于签发令牌，旧密钥将在宽限期后失效；新密钥与令牌模式不匹配时返回错误并继续使用旧密钥
+	RotateKeys() error
+	// IssueAPIKey 为用户签发命名的API密钥，scopes 为空时不额外限制资源范围，expire 为 0 时永不过期。密钥明文仅在签发时返回
+	IssueAPIKey(username string, name string, scopes []string, expire time.Duration) (string, *APIKey, error)
+	// ListAPIKeys 获取用户的所有API密钥
+	ListAPIKeys(username string) ([]*APIKey, error)
+	// RevokeAPIKey 吊销用户的API密钥
+	RevokeAPIKey(username string, id string) error
+	// GetConsumerWithAPIKey 通过API密钥获取消费者，该消费者不会创建会话，角色来源于 SetRoleCheck 设置的函数。认证成功及失败均会写入审计存储
+	GetConsumerWithAPIKey(key string) (Consumer, error)
+	// Refresh 使用刷新令牌轮换访问令牌及刷新令牌（需通过 WithRefreshToken 启用）
+	Refresh(refreshToken string) (Consumer, error)
 	// GetAllConsumer 获取所有消费者
 	GetAllConsumer() []Consumer
-	// Ban 踢出消费者
+	// Ban 踢出消费者，操作者记录为 ActorSystem，需记录具体操作者时应使用 BanBy
 	Ban(consumer Consumer) error
+	// BanBy 踢出消费者并记录发起操作的用户，参考 Event.Actor
+	BanBy(consumer Consumer, actor string) error
 	// SetExpired 设置消费者登录凭证过期时间
 	SetExpired(expired time.Duration) error
 	// SetUnAllowManyClient 设置禁止多端登录
 	SetUnAllowManyClient()
 	// SetAllowManyClient 设置允许多端登录(需要传入客户端标记获取函数，避免一端退出全端退出)
 	SetAllowManyClient(clientTag func() string)
-	// AddTempAccount 添加临时账号
+	// AddTempAccount 添加临时账号，密码将以 WithPasswordHasher 设置的哈希器生成哈希后存储
 	AddTempAccount(username string, password string)
+	// SetMaxClients 限制每个用户同时登录的客户端数量，n 小于等于 0 时取消限制。需通过 SetAllowManyClient 允许多端登录
+	//
+	// 达到上限时按 policy 拒绝新的登录或踢出已登录的客户端，修改限制不会踢出已登录的客户端，将在下次登录时生效
+	SetMaxClients(n int, policy EvictionPolicy)
+	// SetMaxClientsPerType 按登录时设置的 Device.ClientType 限制每个用户同时登录的客户端数量，如 web、mobile、desktop 各一个，未配置的类型不限制
+	SetMaxClientsPerType(limits map[string]int, policy EvictionPolicy)
 	// GetMultiConsumer 获取特定消费者正在多端登录的其他消费者
 	GetMultiConsumer(consumer Consumer) []Consumer
 	// SetRoleCheck 设置角色资源设置函数，将可以检查特定消费者是否拥有特定资源对权限。该函数将返回一个刷新函数
 	SetRoleCheck(roleSetter func(username string, roleHelper *RoleHelper) ([]Role, error))
-	// RefreshRole 刷新特定消费者角色资源
+	// SetRoleCheckContext 同 SetRoleCheck，角色设置函数将接收调用方的 ctx
+	SetRoleCheckContext(roleSetter func(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error))
+	// RefreshRole 刷新特定消费者角色资源，已登录的消费者将同步存储到会话中
 	RefreshRole(consumer Consumer) error
-
-	// 获取临时账号密码库
-	getTempAccount() map[string]string
+	// RefreshRoleContext 刷新特定消费者角色资源，ctx 将传递至角色设置函数
+	RefreshRoleContext(ctx context.Context, consumer Consumer) error
+	// ListSessions 获取用户所有已登录的会话及设备信息，按登录时间排序
+	ListSessions(username string) ([]SessionInfo, error)
+	// RevokeSession 踢出用户的特定会话，会话不属于该用户时返回 ErrNotLoggedIn
+	RevokeSession(username string, sessionId string) error
+	// UnlockAccount 手动解锁因多次登录失败被锁定的账号并清零失败次数
+	UnlockAccount(username string) error
+	// UnlockSourceIP 手动解锁因多次登录失败被锁定的来源IP并清零失败次数
+	UnlockSourceIP(ip string) error
+
+	// Hook 添加同步执行的事件钩子，types 为空时关注所有事件，返回移除该钩子的函数
+	//
+	// 钩子在操作生效前执行，返回错误时将拒绝该操作（参考 EventType 的说明），操作将返回 ErrVetoed
+	Hook(hook func(ctx context.Context, event Event) error, types ...EventType) func()
+	// Subscribe 添加异步执行的事件订阅者，事件将在操作生效后按顺序通知，types 为空时关注所有事件，返回取消订阅的函数
+	Subscribe(subscriber func(event Event), types ...EventType) func()
+	// Close 停止认证器的后台任务（如 WithSessionExpiryCheck 的过期检查）并取消所有订阅者，重复调用无副作用
+	Close() error
+
+	// 校验临时账号密码
+	verifyTempAccount(username string, password string) error
 	// 加入消费者
-	join(consumer Consumer) error
+	join(ctx context.Context, consumer Consumer) error
+	// 踢出消费者并触发特定类型的事件，actor 为发起操作的用户
+	ban(consumer Consumer, eventType EventType, actor string) error
+	// 由系统踢出所有消费者，踢出失败时记录日志并继续
+	banAll()
+	// 执行钩子并通知订阅者，钩子返回的错误将被忽略
+	notify(ctx context.Context, event Event)
+	// 获取日志记录器
+	getLogger() Logger
 	// 获取消费者session
 	getSession(consumer Consumer) (session.Session, error)
-	// 获取rsa
-	getRsa() *cipher.RSA
 	// 获取是否允许多端登录
 	getAllowManyClient() bool
 	// 获取客户端标记生成深航
 	getAllowManyClientFunc() func() string
+	// 检查用户是否需要二次验证
+	mfaRequired(username string) (bool, error)
+	// 为用户创建二次验证挑战
+	newMFAChallenge(username string) (string, error)
+	// 校验二次验证挑战并返回用户名，挑战存在但校验失败时同样返回用户名，ip 为来源IP
+	verifyMFAChallenge(challengeId string, code string, ip string) (string, error)
+	// 生成并发送登录验证码
+	sendLoginCode(username string) error
+	// 校验登录验证码，ip 为来源IP
+	verifyLoginCode(username string, code string, ip string) error
+	// 锁定用户的密码校验，返回解锁函数
+	lockLogin(username string) func()
+	// 检查用户名及来源IP是否因多次登录失败被锁定
+	checkLockout(username string, ip string) error
+	// 记录一次密码登录失败
+	loginFailed(username string, ip string)
+	// 密码登录成功后清零失败次数
+	loginSucceeded(username string)
+	// 保存OIDC授权状态
+	saveOIDCState(state string, nonce string, verifier string) error
+	// 取出并销毁OIDC授权状态
+	takeOIDCState(state string) (nonce string, verifier string, err error)
 }
 
-func New(manager session.Manager) (Auth, error) {
+func New(manager session.Manager, options ...Option) (Auth, error) {
 	auth := &auth{
-		tempAccount: map[string]string{},
-		sm:          manager,
-		rsa:         &cipher.RSA{},
+		sm: newSyncManager(manager),
 
 		allowManyClient: false,
+		keyGracePeriod:  defaultKeyGracePeriod,
+		apiKeys:         NewMemoryAPIKeyStore(),
+		credentials:     NewMemoryCredentialStore(),
+		hasher:          NewArgon2idHasher(0, 0, 0),
+		logger:          stdLogger{},
+		closed:          make(chan struct{}),
+	}
+	for _, option := range options {
+		if err := option(auth); err != nil {
+			return nil, err
+		}
+	}
+
+	// 初始化密钥环，密钥需与令牌模式匹配
+	provider := auth.keyProvider
+	check := checkRsaTokenKey
+	if auth.jwtOptions != nil {
+		check = checkJWTTokenKey
+		if len(auth.jwtOptions.Secret) > 0 {
+			if provider != nil {
+				return nil, errors.New("jwt secret and key provider cannot be used together")
+			}
+			provider = NewStaticKeyProvider(&Key{Secret: auth.jwtOptions.Secret})
+		}
 	}
-	if err := auth.rsa.GenRsaKey(1024); err != nil {
+	if provider == nil {
+		provider = NewGeneratedKeyProvider(defaultKeyBits)
+	}
+	ring, err := newKeyRing(provider, auth.keyGracePeriod, check)
+	if err != nil {
 		return nil, err
 	}
+	auth.keys = ring
+
+	if auth.jwtOptions != nil {
+		jwtOptions := *auth.jwtOptions
+		if auth.refreshOptions != nil {
+			jwtOptions.Expire = auth.refreshOptions.AccessExpire
+		}
+		auth.tokenizer = newJWTTokenizer(jwtOptions, ring)
+	} else {
+		auth.tokenizer = newRsaTokenizer(ring)
+	}
+	if auth.expiryCheck > 0 {
+		go auth.watchSessionExpiry()
+	}
 	return auth, nil
 }
 
 type auth struct {
-	sync.Mutex                    // 备用互斥锁，sm本身支持并发操作。
-	tempAccount map[string]string // 临时的内存存储的用户账号密码集合
-	sm          session.Manager   // 会话管理器（支持并发）
-	rsa         *cipher.RSA       // rsa加密
+	sync.Mutex                  // 备用互斥锁，sm本身支持并发操作。
+	credentials CredentialStore // 临时账号的密码哈希存储
+	hasher      PasswordHasher  // 临时账号的密码哈希器
+	sm          session.Manager // 会话管理器，经 syncManager 包装后加锁访问
+	tokenizer   tokenizer       // 令牌编解码器
+	jwtOptions  *JWTOptions     // JWT令牌模式配置，为空时采用RSA加密标记令牌
+
+	keys           *keyRing      // 密钥环
+	keyProvider    KeyProvider   // 密钥提供者
+	keyGracePeriod time.Duration // 轮换后旧密钥的宽限期
+
+	refreshOptions *RefreshOptions // 刷新令牌配置，为空时不签发刷新令牌
+	familyLocks    keyedMutex      // 刷新令牌族锁，保证同一令牌族的轮换串行执行
+	mfaStore       MFAStore        // 二次验证绑定信息存储，为空时不进行二次验证
+	mfaLocks       keyedMutex      // 二次验证用户锁，保证同一用户的校验及失败计数串行执行
+	codeSender     Sender          // 验证码发送器，为空时不支持验证码登录
+	codeOptions    CodeOptions     // 验证码登录配置
+	codeLocks      keyedMutex      // 验证码用户锁，保证同一用户的发送、校验及尝试计数串行执行
+	apiKeys        APIKeyStore     // API密钥存储
+	lockoutOptions *LockoutOptions // 防暴力破解配置，为空时不限制登录失败次数
+	lockoutLock    sync.Mutex      // 保护登录失败计数
+	loginLocks     keyedMutex      // 密码登录用户锁，启用防暴力破解时保证同一用户的锁定检查、密码校验及失败计数串行执行
 
 	allowManyClient bool          // 是否允许多端登录，如果不允许。将会一方登入，另一方掉线
 	clientTagFunc   func() string // 客户端标记获取函数
-
-	roleSetter func(username string, roleHelper *RoleHelper) ([]Role, error) // 消费者资源查询函数
+	clientLimits    []clientLimit // 客户端数量限制
+	clientLimitLock sync.Mutex    // 保证检查客户端数量与登录的原子性
+	indexLocks      keyedMutex    // 用户会话索引锁，保证同一用户的会话索引更新串行执行
+
+	events          eventBus          // 事件总线
+	expiryCheck     time.Duration     // 会话过期检查间隔，为 0 时不检查
+	trackedSessions map[string]string // 由该认证器创建的会话（会话id:用户名），用于检查会话过期
+	trackedLock     sync.Mutex
+	closed          chan struct{} // 认证器关闭时关闭，用于停止后台任务
+	closeOnce       sync.Once
+	auditSinks      []AuditSink // 审计存储
+	logger          Logger      // 日志记录器
+
+	roleSetter func(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error) // 消费者资源查询函数
 }
 
 func (slf *auth) IsLoginWithToken(token string) bool {
-	tag, err := slf.rsa.RsaDecrypt([]byte(token))
-	if err != nil {
-		return false
-	}
-	_, err = slf.GetConsumer(string(tag))
+	_, err := slf.GetConsumerWithToken(token)
 	return err == nil
 }
 
@@ -94,33 +238,95 @@ func (slf *auth) IsLogin(consumer Consumer) bool {
 }
 
 func (slf *auth) GetConsumerWithToken(token string) (Consumer, error) {
-	tag, err := slf.rsa.RsaDecrypt([]byte(token))
+	return slf.GetConsumerWithTokenContext(context.Background(), token)
+}
+
+func (slf *auth) GetConsumerWithTokenContext(ctx context.Context, token string) (Consumer, error) {
+	claims, err := slf.ParseToken(token)
 	if err != nil {
 		return nil, err
 	}
-	return slf.GetConsumer(string(tag))
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	consumer, err := slf.GetConsumer(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if slf.refreshOptions != nil {
+		if err = slf.checkAccessToken(consumer, token); err != nil {
+			return nil, err
+		}
+	}
+	// 最后活跃时间仅用于展示，更新失败时不影响认证结果
+	_ = slf.touch(consumer)
+	return consumer, nil
+}
+
+func (slf *auth) RotateKeys() error {
+	return slf.keys.rotate()
+}
+
+func (slf *auth) ParseToken(token string) (*Claims, error) {
+	return slf.tokenizer.parse(token)
 }
 
 func (slf *auth) RefreshRole(consumer Consumer) error {
-	if slf.roleSetter != nil {
-		roles, err := slf.roleSetter(consumer.GetUsername(), &RoleHelper{})
-		if err != nil {
-			return err
-		}
+	return slf.RefreshRoleContext(context.Background(), consumer)
+}
+
+func (slf *auth) RefreshRoleContext(ctx context.Context, consumer Consumer) error {
+	return slf.refreshRole(ctx, consumer, true)
+}
+
+// 刷新消费者角色，stored 为真时触发 EventRolesRefreshed 事件，并将消费者重新存储到会话中，使基于序列化的会话管理器（如 Redis）同步新的角色
+func (slf *auth) refreshRole(ctx context.Context, consumer Consumer, stored bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if slf.roleSetter == nil {
+		return nil
+	}
+	roles, err := slf.roleSetter(ctx, consumer.GetUsername(), &RoleHelper{})
+	if err != nil {
+		return err
+	}
+	if !stored {
 		consumer.setRole(roles...)
+		return nil
+	}
+	event := newEvent(Event{Type: EventRolesRefreshed, Consumer: consumer, Roles: roles})
+	if err = slf.emit(ctx, event); err != nil {
+		return err
 	}
+	consumer.setRole(roles...)
+	if ses, err := slf.sm.GetSession(consumer.GetTag()); err == nil {
+		if err = ses.Store(consumer.GetTag(), consumer); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+	slf.publish(event)
 	return nil
 }
 
 func (slf *auth) SetRoleCheck(roleSetter func(username string, roleHelper *RoleHelper) ([]Role, error)) {
+	if roleSetter == nil {
+		slf.SetRoleCheckContext(nil)
+		return
+	}
+	slf.SetRoleCheckContext(func(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error) {
+		return roleSetter(username, roleHelper)
+	})
+}
+
+func (slf *auth) SetRoleCheckContext(roleSetter func(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error)) {
 	// 退出所有账号
 	slf.Lock()
-	for _, c := range slf.GetAllConsumer() {
-		c.OutLogin()
-	}
+	slf.banAll()
 	slf.allowManyClient = false
 	slf.roleSetter = roleSetter
 	slf.Unlock()
+	slf.audit(AuditRecord{Action: AuditActionRoleCheckChanged, Actor: ActorSystem})
 }
 
 func (slf *auth) GetMultiConsumer(consumer Consumer) []Consumer {
@@ -137,31 +343,35 @@ func (slf *auth) getAllowManyClientFunc() func() string {
 	return slf.clientTagFunc
 }
 
-func (slf *auth) getAllowManyClient() bool {
-	return slf.allowManyClient
+func (slf *auth) getLogger() Logger {
+	return slf.logger
 }
 
-func (slf *auth) getRsa() *cipher.RSA {
-	return slf.rsa
+func (slf *auth) getAllowManyClient() bool {
+	return slf.allowManyClient
 }
 
 func (slf *auth) AddTempAccount(username string, password string) {
-	slf.tempAccount[username] = password
+	encoded, err := slf.hasher.Hash(password)
+	if err == nil {
+		err = slf.credentials.Set(username, encoded)
+	}
+	if err != nil {
+		slf.logger.Error("add temp account failed", logKeyUsername, username, logKeyError, err)
+	}
 }
 
 func (slf *auth) SetUnAllowManyClient() {
 	// 退出所有账号
 	slf.Lock()
-	for _, c := range slf.GetAllConsumer() {
-		c.OutLogin()
-	}
+	slf.banAll()
 	slf.allowManyClient = false
 	slf.Unlock()
 }
 
 func (slf *auth) SetAllowManyClient(clientTag func() string) {
 	if clientTag == nil {
-		fmt.Println("set allow many client login failed, not found client Tag getter.")
+		slf.logger.Warn("set allow many client failed, client tag getter is nil")
 		return
 	}
 	slf.allowManyClient = true
@@ -173,7 +383,11 @@ func (slf *auth) SetExpired(expired time.Duration) error {
 }
 
 func (slf *auth) getSession(consumer Consumer) (session.Session, error) {
-	return slf.sm.GetSession(consumer.GetTag())
+	ses, err := slf.sm.GetSession(consumer.GetTag())
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	return ses, nil
 }
 
 func (slf *auth) GetAllConsumer() []Consumer {
@@ -201,15 +415,51 @@ func (slf *auth) GetAllConsumer() []Consumer {
 }
 
 func (slf *auth) Ban(consumer Consumer) error {
-	if s, err := slf.getSession(consumer); err == nil {
-		return slf.sm.UnRegisterSession(s)
+	return slf.ban(consumer, EventBanned, ActorSystem)
+}
+
+func (slf *auth) BanBy(consumer Consumer, actor string) error {
+	return slf.ban(consumer, EventBanned, actor)
+}
+
+func (slf *auth) banAll() {
+	for _, c := range slf.GetAllConsumer() {
+		if err := slf.ban(c, EventBanned, ActorSystem); err != nil {
+			slf.getLogger().Warn("ban consumer failed", logKeyConsumer, c.GetTag(), logKeyUsername, c.GetUsername(), logKeyError, err)
+		}
 	}
+}
+
+func (slf *auth) ban(consumer Consumer, eventType EventType, actor string) error {
+	s, err := slf.getSession(consumer)
+	if err != nil {
+		return nil
+	}
+	event := newEvent(Event{Type: eventType, Consumer: consumer, Actor: actor})
+	if err = slf.emit(context.Background(), event); err != nil {
+		return err
+	}
+	if family, err := loadString(s, sessionKeyRefreshFamily); err == nil {
+		slf.revokeRefreshFamily(family)
+	}
+	if err = slf.sm.UnRegisterSession(s); err != nil {
+		return wrapError(ErrStore, err)
+	}
+	slf.untrackSession(consumer.GetTag())
+	if err = slf.updateSessionIndex(consumer.GetUsername(), "", consumer.GetTag()); err != nil {
+		slf.getLogger().Warn("update session index failed", logKeyUsername, consumer.GetUsername(), logKeyError, err)
+	}
+	slf.publish(event)
 	return nil
 }
 
 func (slf *auth) GetConsumer(tag string) (Consumer, error) {
 	s, err := slf.sm.GetSession(tag)
 	if err != nil {
+		err = sessionError(err)
+		if errors.Is(err, ErrNotLoggedIn) {
+			slf.sessionExpired(tag)
+		}
 		return nil, err
 	}
 	c, err := s.Load(tag)
@@ -218,74 +468,132 @@ func (slf *auth) GetConsumer(tag string) (Consumer, error) {
 		case Consumer:
 			return c.(Consumer), nil
 		default:
-			return slf.jsonToConsumer(c)
+			if c, err := slf.jsonToConsumer(c); err != nil {
+				return nil, wrapError(ErrStore, err)
+			} else {
+				return c, nil
+			}
 		}
 	}
-	return nil, err
+	return nil, sessionError(err)
 }
 
 func (slf *auth) Login() LoginModeSelector {
-	return newLoginModeSelector(slf)
+	return slf.LoginContext(context.Background())
 }
 
-func (slf *auth) getTempAccount() map[string]string {
-	return slf.tempAccount
+func (slf *auth) LoginContext(ctx context.Context) LoginModeSelector {
+	return newLoginModeSelector(slf, ctx)
 }
 
-func (slf *auth) join(consumer Consumer) error {
+func (slf *auth) join(ctx context.Context, consumer Consumer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// 检查是否已登录，避免重复登录
 	consumerTag := consumer.GetTag()
 	if ses, err := slf.sm.GetSession(consumerTag); err != nil {
-		err = slf.RefreshRole(consumer)
+		err = slf.refreshRole(ctx, consumer, false)
 		if err != nil {
 			return err
 		}
-		token, err := slf.newToken(consumerTag)
-		if err != nil {
+		event := newEvent(Event{Type: EventLoginSucceeded, Consumer: consumer})
+		if err = slf.emit(ctx, event); err != nil {
 			return err
 		}
-
-		ses, err = slf.sm.RegisterSession(consumerTag)
+		ses, err := slf.registerConsumer(consumer)
 		if err != nil {
 			return err
 		}
-		err = ses.Store(consumerTag, consumer)
+		err = slf.touch(consumer)
 		if err != nil {
 			return err
 		}
-		err = ses.Store("token", token)
+		err = slf.issueToken(consumer, ses)
 		if err != nil {
 			return err
 		}
+		if slf.refreshOptions != nil {
+			err = slf.newRefreshFamily(consumer, ses)
+			if err != nil {
+				return err
+			}
+		}
+		slf.trackSession(consumer)
+		slf.publish(event)
 	} else {
 		// 如果禁止多端登录，那么凭证将会使用不同的，并在登录前踢出其他凭证账号
 		if !slf.allowManyClient {
-			err = slf.RefreshRole(consumer)
+			err = slf.refreshRole(ctx, consumer, false)
 			if err != nil {
 				return err
 			}
-			token, err := slf.newToken(consumerTag)
+		}
+		event := newEvent(Event{Type: EventLoginSucceeded, Consumer: consumer})
+		if err = slf.emit(ctx, event); err != nil {
+			return err
+		}
+		if !slf.allowManyClient {
+			// 记录新的设备信息
+			err = ses.Store(consumerTag, consumer)
 			if err != nil {
-				return err
+				return wrapError(ErrStore, err)
 			}
 			// 刷新token
-			err = ses.Store("token", token)
+			err = slf.issueToken(consumer, ses)
 			if err != nil {
 				return err
 			}
+			if slf.refreshOptions != nil {
+				err = slf.newRefreshFamily(consumer, ses)
+				if err != nil {
+					return err
+				}
+			}
 		}
+		slf.publish(event)
 	}
 
 	return nil
 }
 
-func (slf *auth) newToken(tag string) (string, error) {
-	// 生成token
-	token, err := slf.rsa.RsaEncrypt([]byte(tag))
+// 检查客户端数量限制并注册消费者会话
+//
+// 需要踢出客户端时，将在释放锁后踢出（触发 EventEvicted 钩子）并重新检查，任一踢出失败或被钩子拒绝时拒绝新的登录
+func (slf *auth) registerConsumer(consumer Consumer) (session.Session, error) {
+	for i := 0; ; i++ {
+		ses, victims, err := slf.tryRegisterConsumer(consumer)
+		if err != nil || ses != nil {
+			return ses, err
+		}
+		if i >= clientLimitRetries {
+			return nil, newError(ErrTooManyClients, "clients changed concurrently, please try again")
+		}
+		if err = slf.evictSessions(consumer.GetUsername(), victims); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 在持有 clientLimitLock 时检查客户端数量限制，无需踢出时注册消费者会话，否则返回需要踢出的会话id
+func (slf *auth) tryRegisterConsumer(consumer Consumer) (session.Session, []string, error) {
+	slf.clientLimitLock.Lock()
+	defer slf.clientLimitLock.Unlock()
+	victims, err := slf.enforceClientLimits(consumer)
+	if err != nil || len(victims) > 0 {
+		return nil, victims, err
+	}
+	ses, err := slf.sm.RegisterSession(consumer.GetTag())
 	if err != nil {
-		return "", err
+		return nil, nil, wrapError(ErrStore, err)
+	}
+	if err = ses.Store(consumer.GetTag(), consumer); err != nil {
+		return nil, nil, wrapError(ErrStore, err)
+	}
+	if err = slf.updateSessionIndex(consumer.GetUsername(), consumer.GetTag()); err != nil {
+		return nil, nil, err
 	}
-	return string(token), nil
+	return ses, nil, nil
 }
 
 func (slf *auth) jsonToConsumer(redisConsumerInterface interface{}) (Consumer, error) {
@@ -1,8 +1,20 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"github.com/kercylan98/go-session/session"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -79,3 +91,811 @@ func TestAuth_SetRoleCheck(t *testing.T) {
 		}
 	}
 }
+
+func TestAuth_JWT(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithJWT(JWTOptions{
+		Issuer: "go-auth",
+		Secret: []byte("secret"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 网关离线校验
+	claims, err := NewJWTVerifier([]byte("secret"), "go-auth").Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "admin" || claims.SessionID != consumer.GetTag() {
+		t.Fatal("unexpected claims", claims)
+	}
+	if _, err = NewJWTVerifier([]byte("other"), "go-auth").Verify(token); err == nil {
+		t.Fatal("token signed by other secret should be rejected")
+	}
+
+	if !auth.IsLoginWithToken(token) || !consumer.CheckToken(token) {
+		t.Fatal("jwt token should be valid")
+	}
+	if c, err := auth.GetConsumerWithToken(token); err != nil || c.GetTag() != consumer.GetTag() {
+		t.Fatal("get consumer with jwt token failed", err)
+	}
+}
+
+func TestAuth_Refresh(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _ := consumer.GetToken()
+	refreshToken, err := consumer.GetRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换令牌
+	consumer, err = auth.Refresh(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAccessToken, _ := consumer.GetToken()
+	newRefreshToken, _ := consumer.GetRefreshToken()
+	if newRefreshToken == refreshToken {
+		t.Fatal("refresh token should be rotated")
+	}
+	if auth.IsLoginWithToken(accessToken) || !auth.IsLoginWithToken(newAccessToken) {
+		t.Fatal("only the rotated access token should be valid")
+	}
+
+	// 重复使用已轮换的刷新令牌将吊销整个令牌族
+	if _, err = auth.Refresh(refreshToken); err == nil {
+		t.Fatal("reused refresh token should be rejected")
+	}
+	if auth.IsLogin(consumer) {
+		t.Fatal("consumer should be logged out after refresh token reuse")
+	}
+	if _, err = auth.Refresh(newRefreshToken); err == nil {
+		t.Fatal("token family should be revoked")
+	}
+}
+
+func TestAuth_RefreshReuseGeneration(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := consumer.GetRefreshToken()
+
+	// 无论已轮换多少次，代数低于当前代数的刷新令牌再次出现时都将吊销整个令牌族
+	for i := 0; i < 64; i++ {
+		refreshToken, _ := consumer.GetRefreshToken()
+		if consumer, err = auth.Refresh(refreshToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = auth.Refresh(first); !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "reused") {
+		t.Fatal("expect refresh token reuse, got", err)
+	}
+	if auth.IsLogin(consumer) {
+		t.Fatal("consumer should be logged out after refresh token reuse")
+	}
+}
+
+func TestAuth_RefreshLegacy(t *testing.T) {
+	manager := session.NewManagerMemory()
+	auth, err := New(manager, WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, _ := consumer.GetRefreshToken()
+	familyId, _, _, _ := parseRefreshToken(refreshToken)
+	family, err := manager.GetSession(refreshFamilyPrefix + familyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 升级前签发的 v1 刷新令牌视为第0代，轮换后得到携带代数的新令牌
+	secret, err := newRefreshSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = family.Store(familyKeyCurrent, refreshDigest(secret)); err != nil {
+		t.Fatal(err)
+	}
+	legacy := encodeToken(tokenVersion1, append([]byte(familyId), secret...))
+	if consumer, err = auth.Refresh(legacy); err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, _ = consumer.GetRefreshToken()
+	if _, generation, _, _ := parseRefreshToken(refreshToken); generation != 1 {
+		t.Fatal("unexpected generation", generation)
+	}
+	if _, err = auth.Refresh(legacy); err == nil || auth.IsLogin(consumer) {
+		t.Fatal("reused legacy refresh token should revoke the family")
+	}
+}
+
+func TestAuth_RefreshConcurrent(t *testing.T) {
+	manager := session.NewManagerMemory()
+	auth, err := New(manager, WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次轮换令牌族的代数加一，令牌携带的代数与令牌族一致
+	for i := 0; i < 8; i++ {
+		refreshToken, _ := consumer.GetRefreshToken()
+		if consumer, err = auth.Refresh(refreshToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refreshToken, _ := consumer.GetRefreshToken()
+	familyId, generation, _, _ := parseRefreshToken(refreshToken)
+	family, err := manager.GetSession(refreshFamilyPrefix + familyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := loadString(family, familyKeyCurrent)
+	if currentGeneration, _ := parseFamilyCurrent(current); generation != 9 || currentGeneration != generation {
+		t.Fatal("unexpected generation", generation, currentGeneration)
+	}
+
+	// 同一刷新令牌并发轮换时仅有一次成功
+	var succeeded int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := auth.Refresh(refreshToken); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatal("expect exactly one successful refresh, got", succeeded)
+	}
+}
+
+func TestAuth_RotateKeys(t *testing.T) {
+	for _, jwt := range []bool{false, true} {
+		var options = []Option{WithKeyProvider(NewGeneratedKeyProvider(1024))}
+		if jwt {
+			options = append(options, WithJWT(JWTOptions{}))
+		}
+		auth, err := New(session.NewManagerMemory(), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth.AddTempAccount("admin", "12345")
+		consumer, err := auth.Login().Password("admin", "12345")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := consumer.GetToken()
+
+		// 宽限期内旧密钥签发的令牌仍然有效
+		if err = auth.RotateKeys(); err != nil {
+			t.Fatal(err)
+		}
+		if !auth.IsLoginWithToken(token) {
+			t.Fatal("token issued by retired key should be valid during grace period")
+		}
+	}
+
+	// 宽限期为0时旧密钥立即失效
+	auth, err := New(session.NewManagerMemory(), WithKeyProvider(NewGeneratedKeyProvider(1024)), WithKeyGracePeriod(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := consumer.GetToken()
+	if err = auth.RotateKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsLoginWithToken(token) {
+		t.Fatal("token issued by retired key should be rejected after grace period")
+	}
+}
+
+func TestAuth_KeyMode(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RSA 令牌模式不接受仅包含公钥或对称密钥的密钥
+	for _, key := range []*Key{{PublicKey: &privateKey.PublicKey}, {Secret: []byte("secret")}} {
+		if _, err = New(session.NewManagerMemory(), WithKeyProvider(NewStaticKeyProvider(key))); err == nil {
+			t.Fatal("rsa token should require an rsa private key")
+		}
+	}
+	if _, err = New(session.NewManagerMemory(), WithKeyProvider(NewStaticKeyProvider(&Key{PublicKey: &privateKey.PublicKey})), WithJWT(JWTOptions{})); err == nil {
+		t.Fatal("jwt token should require a signing key")
+	}
+	if _, err = New(session.NewManagerMemory(), WithKeyProvider(NewGeneratedKeyProvider(1024)), WithJWT(JWTOptions{Secret: []byte("secret")})); err == nil {
+		t.Fatal("jwt secret and key provider should not be used together")
+	}
+
+	// 轮换得到的密钥与令牌模式不匹配时保留原签发密钥
+	var keys = []*Key{{PrivateKey: privateKey}, {Secret: []byte("secret")}}
+	auth, err := New(session.NewManagerMemory(), WithKeyProvider(KeyProviderFunc(func() (*Key, error) {
+		key := keys[0]
+		if len(keys) > 1 {
+			keys = keys[1:]
+		}
+		return newKey(key)
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	if err = auth.RotateKeys(); err == nil {
+		t.Fatal("rotating to a symmetric key should be rejected in rsa token mode")
+	}
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := consumer.GetToken()
+	if !auth.IsLoginWithToken(token) {
+		t.Fatal("active key should be kept after a rejected rotation")
+	}
+}
+
+func TestParsePEMKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	// 相同的PEM密钥在不同副本中得到相同的密钥id，签发的令牌可互相识别
+	a, err := New(session.NewManagerMemory(), WithKeyProvider(NewPEMKeyProvider(data)), WithJWT(JWTOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(session.NewManagerMemory(), WithKeyProvider(NewPEMKeyProvider(data)), WithJWT(JWTOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AddTempAccount("admin", "12345")
+	consumer, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := consumer.GetToken()
+	if _, err = b.ParseToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// 静态密钥提供者不会修改调用方的密钥
+	key := &Key{PrivateKey: privateKey}
+	loaded, err := NewStaticKeyProvider(key).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "" || key.PublicKey != nil || loaded == key || loaded.ID == "" || loaded.PublicKey == nil {
+		t.Fatal("static key provider should fill defaults on a copy")
+	}
+}
+
+func TestAuth_TokenEncoding(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := consumer.GetToken()
+	refreshToken, _ := consumer.GetRefreshToken()
+	for _, s := range []string{token, refreshToken} {
+		if url.QueryEscape(s) != s {
+			t.Fatal("token should be url safe", s)
+		}
+	}
+
+	// 未知版本号的令牌将被拒绝
+	version, payload, err := decodeToken(token)
+	if err != nil || version != tokenVersion1 {
+		t.Fatal("unexpected token version", version, err)
+	}
+	if auth.IsLoginWithToken(encodeToken(tokenVersion1+1, payload)) {
+		t.Fatal("token with unknown version should be rejected")
+	}
+}
+
+func TestAuth_Code(t *testing.T) {
+	sender := NewMemorySender()
+	auth, err := New(session.NewManagerMemory(), WithCodeSender(sender, CodeOptions{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = auth.Login().Code("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.Login().Code("admin"); !errors.Is(err, ErrCodeCooldown) {
+		t.Fatal("resend should be limited by cooldown, got", err)
+	}
+	code := sender.GetCode("admin")
+	if _, err = auth.Login().VerifyCode("admin", code+"0"); err == nil {
+		t.Fatal("invalid code should be rejected")
+	}
+	consumer, err := auth.Login().VerifyCode("admin", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsLogin(consumer) {
+		t.Fatal("consumer should be logged in")
+	}
+	if _, err = auth.Login().VerifyCode("admin", code); err == nil {
+		t.Fatal("code should be consumed")
+	}
+}
+
+func TestAuth_CodeLockout(t *testing.T) {
+	disabled, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = disabled.Login().Code("admin"); !errors.Is(err, ErrNotEnabled) {
+		t.Fatal("expect not enabled, got", err)
+	}
+
+	sender := NewMemorySender()
+	auth, err := New(session.NewManagerMemory(), WithCodeSender(sender, CodeOptions{MaxAttempts: 100}), WithLockout(LockoutOptions{
+		FreeAttempts:    1,
+		MaxAttempts:     2,
+		LockoutDuration: time.Hour,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.Login().Code("admin"); err != nil {
+		t.Fatal(err)
+	}
+	code := sender.GetCode("admin")
+
+	// 验证码错误计入登录失败次数，锁定期间正确的验证码同样被拒绝
+	for i := 0; i < 2; i++ {
+		if _, err = auth.Login().UseSourceIP("10.0.0.1").VerifyCode("admin", code+"0"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("expect invalid credentials, got", err)
+		}
+	}
+	if _, err = auth.Login().VerifyCode("admin", code); !errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect account locked, got", err)
+	}
+	if err = auth.UnlockAccount("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().VerifyCode("admin", code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuth_APIKey(t *testing.T) {
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetRoleCheck(func(username string, roleHelper *RoleHelper) ([]Role, error) {
+		return []Role{
+			roleHelper.NewRole("test-role").
+				AddResourceGroup(roleHelper.NewResourceGroup("test-group").
+					Add(roleHelper.NewResource("hi", "/hi")).
+					Add(roleHelper.NewResource("hello", "/hello"))),
+		}, nil
+	})
+
+	key, info, err := auth.IssueAPIKey("robot", "ci", []string{"/hi"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, err := auth.GetConsumerWithAPIKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumer.GetUsername() != "robot" || !consumer.ResourceExist("/hi") || consumer.ResourceExist("/hello") {
+		t.Fatal("api key consumer should be limited by scopes")
+	}
+	if keys, _ := auth.ListAPIKeys("robot"); len(keys) != 1 || keys[0].Name != "ci" {
+		t.Fatal("unexpected api keys", keys)
+	}
+
+	if err = auth.RevokeAPIKey("robot", info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.GetConsumerWithAPIKey(key); err == nil {
+		t.Fatal("revoked api key should be rejected")
+	}
+}
+
+func TestAuth_Lockout(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithLockout(LockoutOptions{
+		FreeAttempts:    2,
+		MaxAttempts:     4,
+		BaseDelay:       100 * time.Millisecond,
+		LockoutDuration: time.Hour,
+		SourceIPFactor:  1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	auth.AddTempAccount("guest", "12345")
+
+	// 超出不受限制的次数后需等待，等待期间正确的密码同样被拒绝
+	for i := 0; i < 3; i++ {
+		if _, err = auth.Login().Password("admin", "wrong"); err == nil || errors.Is(err, ErrAccountLocked) {
+			t.Fatal("expect wrong password, got", err)
+		}
+	}
+	if _, err = auth.Login().Password("admin", "12345"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect account locked, got", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	// 达到最大次数后锁定
+	if _, err = auth.Login().Password("admin", "wrong"); err == nil || errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect wrong password, got", err)
+	}
+	var lockedErr *AccountLockedError
+	if _, err = auth.Login().Password("admin", "12345"); !errors.As(err, &lockedErr) || time.Until(lockedErr.Until) < 50*time.Minute {
+		t.Fatal("expect account locked for an hour, got", err)
+	}
+	if err = auth.UnlockAccount("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().Password("admin", "12345"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 来源IP单独计数
+	for _, username := range []string{"a", "b", "c"} {
+		_, _ = auth.Login().UseSourceIP("10.0.0.1").Password(username, "wrong")
+	}
+	if _, err = auth.Login().UseSourceIP("10.0.0.1").Password("guest", "12345"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect source ip locked, got", err)
+	}
+	if _, err = auth.Login().UseSourceIP("10.0.0.2").Password("guest", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.UnlockSourceIP("10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().UseSourceIP("10.0.0.1").Password("guest", "12345"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发猜测在失败被记录前不能全部通过锁定检查
+	var evaluated int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = auth.Login().UsePasswordChecker(func(username string, password string) error {
+				atomic.AddInt32(&evaluated, 1)
+				time.Sleep(time.Millisecond)
+				return errors.New("wrong password")
+			}).Password("robot", "wrong")
+		}()
+	}
+	wg.Wait()
+	if evaluated != 3 {
+		t.Fatal("expect 3 evaluated guesses, got", evaluated)
+	}
+}
+
+func TestAuth_Errors(t *testing.T) {
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+
+	if _, err = auth.Login().Password("admin", "54321"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal("expect invalid credentials, got", err)
+	}
+	if _, err = auth.Login().UsePasswordChecker(func(username string, password string) error {
+		return errors.New("rejected by checker")
+	}).Password("admin", "12345"); !errors.Is(err, ErrInvalidCredentials) || errors.Unwrap(err).Error() != "rejected by checker" {
+		t.Fatal("expect wrapped invalid credentials, got", err)
+	}
+	if _, err = auth.GetConsumer("nobody"); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatal("expect not logged in, got", err)
+	}
+	if _, err = auth.GetConsumerWithToken("undecryptable"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatal("expect invalid token, got", err)
+	}
+
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = consumer.Authorize("/hi"); !errors.Is(err, ErrForbidden) {
+		t.Fatal("expect forbidden, got", err)
+	}
+
+	secret := &Key{Secret: []byte("secret")}
+	token, err := signJWT(secret, &Claims{SessionID: consumer.GetTag(), ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewJWTVerifier(secret, "").Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatal("expect token expired, got", err)
+	}
+
+	if err = sessionError(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")); !errors.Is(err, ErrStore) {
+		t.Fatal("expect store error, got", err)
+	}
+
+	// 未启用的功能及格式错误的刷新令牌
+	if _, err = auth.Refresh("malformed"); !errors.Is(err, ErrNotEnabled) {
+		t.Fatal("expect not enabled, got", err)
+	}
+	refreshAuth, err := New(session.NewManagerMemory(), WithRefreshToken(RefreshOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, refreshToken := range []string{"malformed", encodeToken(tokenVersion2+1, nil), encodeToken(tokenVersion1, []byte("short"))} {
+		if _, err = refreshAuth.Refresh(refreshToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatal("expect invalid token, got", err)
+		}
+	}
+
+	// API密钥存储不可用时返回 ErrStore，密钥不存在时返回 ErrInvalidCredentials
+	key, _, err := auth.IssueAPIKey("admin", "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = auth.RevokeAPIKey("admin", "unknown"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal("expect invalid credentials, got", err)
+	}
+	storeAuth, err := New(session.NewManagerMemory(), WithAPIKeyStore(failedAPIKeyStore{NewMemoryAPIKeyStore()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storeAuth.GetConsumerWithAPIKey(key); !errors.Is(err, ErrStore) {
+		t.Fatal("expect store error, got", err)
+	}
+}
+
+type failedAPIKeyStore struct {
+	*MemoryAPIKeyStore
+}
+
+func (failedAPIKeyStore) Get(id string) (*APIKey, error) {
+	return nil, errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+}
+
+func TestAuth_Context(t *testing.T) {
+	type ctxKey struct{}
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetRoleCheckContext(func(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error) {
+		if ctx.Value(ctxKey{}) != "request" {
+			return nil, errors.New("ctx is not passed to role setter")
+		}
+		return []Role{
+			roleHelper.NewRole("test-role").
+				AddResourceGroup(roleHelper.NewResourceGroup("test-group").
+					Add(roleHelper.NewResource("hi", "/hi"))),
+		}, nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	consumer, err := auth.LoginContext(ctx).UsePasswordCheckerContext(func(ctx context.Context, username string, password string) error {
+		if ctx.Value(ctxKey{}) != "request" {
+			return errors.New("ctx is not passed to password checker")
+		}
+		return nil
+	}).Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !consumer.ResourceExist("/hi") {
+		t.Fatal("role should be set with ctx")
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.GetConsumerWithTokenContext(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = auth.GetConsumerWithTokenContext(canceled, token); !errors.Is(err, context.Canceled) {
+		t.Fatal("expect canceled, got", err)
+	}
+	if _, err = auth.LoginContext(canceled).Password("admin", "12345"); !errors.Is(err, context.Canceled) {
+		t.Fatal("expect canceled, got", err)
+	}
+	if err = auth.RefreshRoleContext(canceled, consumer); !errors.Is(err, context.Canceled) {
+		t.Fatal("expect canceled, got", err)
+	}
+}
+
+func TestAuth_Sessions(t *testing.T) {
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clients = []string{"phone", "laptop"}
+	var next int
+	auth.SetAllowManyClient(func() string {
+		next++
+		return clients[next-1]
+	})
+	auth.AddTempAccount("admin", "12345")
+	phone, err := auth.Login().UseSourceIP("10.0.0.1").UseDevice(Device{ClientType: "ios", UserAgent: "app/1.0"}).Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := auth.Login().UseDevice(Device{ClientType: "web", IP: "10.0.0.2"}).Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := auth.ListSessions("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != phone.GetTag() || sessions[1].SessionID != laptop.GetTag() {
+		t.Fatal("unexpected sessions", sessions)
+	}
+	device := sessions[0].Device
+	if device.ClientType != "ios" || device.UserAgent != "app/1.0" || device.IP != "10.0.0.1" || device.LoginAt.IsZero() || device.LastSeenAt.IsZero() {
+		t.Fatal("unexpected device", device)
+	}
+	if sessions[1].Device.IP != "10.0.0.2" {
+		t.Fatal("unexpected device", sessions[1].Device)
+	}
+
+	if err = auth.RevokeSession("guest", phone.GetTag()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatal("expect not logged in, got", err)
+	}
+	if err = auth.RevokeSession("admin", phone.GetTag()); err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsLogin(phone) || !auth.IsLogin(laptop) {
+		t.Fatal("only the revoked session should be logged out")
+	}
+	if sessions, _ = auth.ListSessions("admin"); len(sessions) != 1 {
+		t.Fatal("expect 1 session, got", len(sessions))
+	}
+}
+
+func TestAuth_SetMaxClients(t *testing.T) {
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var next int
+	auth.SetAllowManyClient(func() string {
+		next++
+		return strconv.Itoa(next)
+	})
+	auth.AddTempAccount("admin", "12345")
+	login := func(clientType string) (Consumer, error) {
+		return auth.Login().UseDevice(Device{ClientType: clientType}).Password("admin", "12345")
+	}
+	count := func() int {
+		sessions, _ := auth.ListSessions("admin")
+		return len(sessions)
+	}
+
+	auth.SetMaxClients(2, RejectNew)
+	first, _ := login("web")
+	second, _ := login("web")
+	if _, err = login("web"); !errors.Is(err, ErrTooManyClients) || count() != 2 {
+		t.Fatal("expect too many clients, got", err)
+	}
+
+	// 最近最少使用的客户端将被踢出
+	for c, lastSeen := range map[Consumer]time.Time{first: time.Now(), second: time.Now().Add(-time.Hour)} {
+		ses, _ := auth.getSession(c)
+		_ = ses.Store(sessionKeyLastSeen, strconv.FormatInt(lastSeen.Unix(), 10))
+	}
+	auth.SetMaxClients(2, EvictLeastRecentlyUsed)
+	third, err := login("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsLogin(first) || auth.IsLogin(second) || !auth.IsLogin(third) {
+		t.Fatal("least recently used client should be evicted")
+	}
+
+	// 按客户端类型限制，修改限制不会踢出已登录的客户端
+	auth.SetMaxClients(0, RejectNew)
+	auth.SetMaxClientsPerType(map[string]int{"web": 1, "mobile": 1}, EvictOldest)
+	if count() != 2 {
+		t.Fatal("changing limits should not log out clients")
+	}
+	mobile, err := login("mobile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, err := login("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsLogin(first) || auth.IsLogin(third) || !auth.IsLogin(mobile) || !auth.IsLogin(web) {
+		t.Fatal("oldest web clients should be evicted")
+	}
+	if _, err = login("desktop"); err != nil || count() != 3 {
+		t.Fatal("unlimited client type should be allowed", err)
+	}
+
+	// 踢出在释放客户端数量限制锁后执行，事件钩子中可以调整限制
+	unhook := auth.Hook(func(ctx context.Context, event Event) error {
+		auth.SetMaxClientsPerType(map[string]int{"web": 1, "mobile": 1}, EvictOldest)
+		return nil
+	}, EventEvicted)
+	defer unhook()
+	if _, err = login("web"); err != nil || auth.IsLogin(web) || count() != 3 {
+		t.Fatal("oldest web client should be evicted", err)
+	}
+	unhook()
+
+	// 钩子拒绝踢出时拒绝新的登录，已登录的客户端保持不变
+	auth.SetMaxClients(1, EvictOldest)
+	sessions, _ := auth.ListSessions("admin")
+	unhook = auth.Hook(func(ctx context.Context, event Event) error {
+		return errors.New("eviction is disabled")
+	}, EventEvicted)
+	if _, err = login("desktop"); !errors.Is(err, ErrVetoed) {
+		t.Fatal("expect vetoed, got", err)
+	}
+	if count() != len(sessions) {
+		t.Fatal("vetoed eviction should keep sessions listed, got", count())
+	}
+	for _, s := range sessions {
+		if c, err := auth.GetConsumer(s.SessionID); err != nil || !auth.IsLogin(c) {
+			t.Fatal("vetoed eviction should keep clients logged in")
+		}
+	}
+}
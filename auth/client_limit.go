@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// EvictionPolicy 用户登录的客户端数量达到上限时的处理策略
+type EvictionPolicy int
+
+const (
+	// RejectNew 拒绝新的登录，返回 ErrTooManyClients
+	RejectNew EvictionPolicy = iota
+	// EvictOldest 踢出登录时间最早的客户端
+	EvictOldest
+	// EvictLeastRecentlyUsed 踢出最后活跃时间最早的客户端
+	EvictLeastRecentlyUsed
+)
+
+const clientLimitRetries = 3 // 踢出客户端后重新检查数量限制的最大次数，并发登录持续占满名额时拒绝登录
+
+// 客户端数量限制
+type clientLimit struct {
+	clientType string         // 限制的客户端类型，为空时限制所有客户端
+	max        int            // 最大客户端数量
+	policy     EvictionPolicy // 达到上限时的处理策略
+}
+
+func (slf *auth) SetMaxClients(n int, policy EvictionPolicy) {
+	slf.clientLimitLock.Lock()
+	defer slf.clientLimitLock.Unlock()
+	limits := slf.clientLimits[:0:0]
+	for _, limit := range slf.clientLimits {
+		if limit.clientType != "" {
+			limits = append(limits, limit)
+		}
+	}
+	if n > 0 {
+		limits = append(limits, clientLimit{max: n, policy: policy})
+	}
+	slf.clientLimits = limits
+}
+
+func (slf *auth) SetMaxClientsPerType(limits map[string]int, policy EvictionPolicy) {
+	slf.clientLimitLock.Lock()
+	defer slf.clientLimitLock.Unlock()
+	result := slf.clientLimits[:0:0]
+	for _, limit := range slf.clientLimits {
+		if limit.clientType == "" {
+			result = append(result, limit)
+		}
+	}
+	for clientType, n := range limits {
+		if clientType != "" && n > 0 {
+			result = append(result, clientLimit{clientType: clientType, max: n, policy: policy})
+		}
+	}
+	slf.clientLimits = result
+}
+
+// 消费者登录前检查客户端数量限制，超出限制时按策略拒绝登录，或返回需要踢出的会话id
+//
+// 需在持有 clientLimitLock 时调用，踢出操作会触发事件钩子，应在释放锁后通过 evictSessions 执行
+func (slf *auth) enforceClientLimits(consumer Consumer) ([]string, error) {
+	if len(slf.clientLimits) == 0 {
+		return nil, nil
+	}
+	sessions, err := slf.ListSessions(consumer.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	clientType := consumer.GetDevice().ClientType
+	var evict = map[string]bool{}
+	for _, limit := range slf.clientLimits {
+		if limit.clientType != "" && limit.clientType != clientType {
+			continue
+		}
+		var matched []SessionInfo
+		for _, s := range sessions {
+			if !evict[s.SessionID] && (limit.clientType == "" || s.Device.ClientType == limit.clientType) {
+				matched = append(matched, s)
+			}
+		}
+		if len(matched) < limit.max {
+			continue
+		}
+		if limit.policy == RejectNew {
+			return nil, newError(ErrTooManyClients, "at most "+strconv.Itoa(limit.max)+" clients are allowed")
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if limit.policy == EvictLeastRecentlyUsed {
+				return matched[i].Device.LastSeenAt.Before(matched[j].Device.LastSeenAt)
+			}
+			return matched[i].Device.LoginAt.Before(matched[j].Device.LoginAt)
+		})
+		for _, s := range matched[:len(matched)-limit.max+1] {
+			evict[s.SessionID] = true
+		}
+	}
+	var victims = make([]string, 0, len(evict))
+	for sessionId := range evict {
+		victims = append(victims, sessionId)
+	}
+	return victims, nil
+}
+
+// 踢出因客户端数量限制而被挤下线的会话，会话仅在注销成功后从用户会话索引中移除
+//
+// 踢出失败或被钩子拒绝时返回错误，此时应拒绝新的登录
+func (slf *auth) evictSessions(username string, victims []string) error {
+	for _, sessionId := range victims {
+		if err := slf.revokeSession(username, sessionId, EventEvicted, ActorSystem); err != nil && !errors.Is(err, ErrNotLoggedIn) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	loginCodePrefix = "__x_x__login_code:" // 登录验证码会话id前缀
+
+	codeKeyDigest   = "digest"   // 验证码摘要
+	codeKeyExpire   = "expire"   // 验证码过期时间
+	codeKeyAttempts = "attempts" // 验证码已尝试次数
+	codeKeySentAt   = "sent_at"  // 验证码发送时间
+)
+
+// Sender 验证码发送器，如邮件、短信等
+type Sender interface {
+	// Send 向用户发送登录验证码，用户不存在等情况下应返回错误
+	Send(username string, code string) error
+}
+
+// CodeOptions 验证码登录配置
+type CodeOptions struct {
+	Length         int           // 验证码长度，默认6位
+	Expire         time.Duration // 验证码有效期，默认5分钟
+	MaxAttempts    int           // 最大尝试次数，超过后验证码失效，默认5次
+	ResendCooldown time.Duration // 重新发送的冷却时间，默认1分钟
+}
+
+// WithCodeSender 启用验证码登录，验证码通过 sender 发送，并通过会话管理器进行存储
+func WithCodeSender(sender Sender, options CodeOptions) Option {
+	return func(auth *auth) error {
+		if sender == nil {
+			return errors.New("code sender is nil")
+		}
+		if options.Length <= 0 {
+			options.Length = 6
+		}
+		if options.Expire <= 0 {
+			options.Expire = 5 * time.Minute
+		}
+		if options.MaxAttempts <= 0 {
+			options.MaxAttempts = 5
+		}
+		if options.ResendCooldown <= 0 {
+			options.ResendCooldown = time.Minute
+		}
+		auth.codeSender = sender
+		auth.codeOptions = options
+		return nil
+	}
+}
+
+// NewMemorySender 创建一个将验证码记录在内存中的发送器，适用于测试
+func NewMemorySender() *MemorySender {
+	return &MemorySender{
+		codes: map[string]string{},
+	}
+}
+
+// MemorySender 将验证码记录在内存中的发送器
+type MemorySender struct {
+	sync.Mutex
+	codes map[string]string // 用户最近一次收到的验证码
+}
+
+// Send 记录发送给用户的验证码
+func (slf *MemorySender) Send(username string, code string) error {
+	slf.Lock()
+	slf.codes[username] = code
+	slf.Unlock()
+	return nil
+}
+
+// GetCode 获取用户最近一次收到的验证码
+func (slf *MemorySender) GetCode(username string) string {
+	slf.Lock()
+	defer slf.Unlock()
+	return slf.codes[username]
+}
+
+// 生成并发送登录验证码
+func (slf *auth) sendLoginCode(username string) error {
+	if slf.codeSender == nil {
+		return newError(ErrNotEnabled, "code login is not enabled")
+	}
+	unlock := slf.codeLocks.Lock(username)
+	defer unlock()
+	now := time.Now()
+	if ses, err := slf.sm.GetSession(loginCodePrefix + username); err == nil {
+		sentAt, _ := loadString(ses, codeKeySentAt)
+		if at, _ := strconv.ParseInt(sentAt, 10, 64); now.Before(time.Unix(at, 0).Add(slf.codeOptions.ResendCooldown)) {
+			wait := time.Unix(at, 0).Add(slf.codeOptions.ResendCooldown).Sub(now).Round(time.Second)
+			return newError(ErrCodeCooldown, "retry after "+wait.String())
+		}
+		_ = slf.sm.UnRegisterSession(ses)
+	}
+
+	code, err := newNumericCode(slf.codeOptions.Length)
+	if err != nil {
+		return err
+	}
+	ses, err := slf.sm.RegisterSession(loginCodePrefix + username)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	for key, value := range map[string]string{
+		codeKeyDigest:   codeDigest(code),
+		codeKeyExpire:   strconv.FormatInt(now.Add(slf.codeOptions.Expire).Unix(), 10),
+		codeKeyAttempts: "0",
+		codeKeySentAt:   strconv.FormatInt(now.Unix(), 10),
+	} {
+		if err = ses.Store(key, value); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+	if err = slf.codeSender.Send(username, code); err != nil {
+		_ = slf.sm.UnRegisterSession(ses)
+		return err
+	}
+	return nil
+}
+
+// 校验登录验证码，验证成功后验证码将失效
+//
+// 同一用户的校验串行执行，并发猜测同样受 MaxAttempts 限制。启用 WithLockout 时，验证码错误将计入用户名及来源IP（ip）的登录失败次数
+func (slf *auth) verifyLoginCode(username string, code string, ip string) error {
+	if slf.codeSender == nil {
+		return newError(ErrNotEnabled, "code login is not enabled")
+	}
+	unlock := slf.codeLocks.Lock(username)
+	defer unlock()
+	if err := slf.checkLockout(username, ip); err != nil {
+		return err
+	}
+	ses, err := slf.sm.GetSession(loginCodePrefix + username)
+	if err != nil {
+		if err = sessionError(err); errors.Is(err, ErrNotLoggedIn) {
+			return newError(ErrInvalidCredentials, "code does not exist or has expired")
+		}
+		return err
+	}
+	expire, err := loadString(ses, codeKeyExpire)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if expireAt, _ := strconv.ParseInt(expire, 10, 64); time.Now().Unix() >= expireAt {
+		_ = slf.sm.UnRegisterSession(ses)
+		return newError(ErrInvalidCredentials, "code does not exist or has expired")
+	}
+	digest, err := loadString(ses, codeKeyDigest)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(codeDigest(code))) != 1 {
+		slf.loginFailed(username, ip)
+		attempts, _ := loadString(ses, codeKeyAttempts)
+		count, _ := strconv.Atoi(attempts)
+		count++
+		if count >= slf.codeOptions.MaxAttempts {
+			_ = slf.sm.UnRegisterSession(ses)
+			return newError(ErrInvalidCredentials, "too many failed code attempts, please request a new code")
+		}
+		if err = ses.Store(codeKeyAttempts, strconv.Itoa(count)); err != nil {
+			return wrapError(ErrStore, err)
+		}
+		return newError(ErrInvalidCredentials, "invalid code")
+	}
+	return wrapError(ErrStore, slf.sm.UnRegisterSession(ses))
+}
+
+// 生成特定长度的随机数字验证码
+func newNumericCode(length int) (string, error) {
+	var code = make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
+
+// 验证码摘要，会话中不保留明文
+func codeDigest(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,7 @@
 package auth
 
 import (
-	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -11,16 +11,30 @@ type Consumer interface {
 	GetTag() string
 	// GetUsername 获取用户名标记
 	GetUsername() string
+	// GetDevice 获取登录时记录的设备信息
+	GetDevice() Device
 	// GetToken 获取消费者token
 	GetToken() (string, error)
-	// CheckToken 验证消费者token是否合法
+	// GetRefreshToken 获取消费者刷新令牌（需通过 WithRefreshToken 启用）
+	GetRefreshToken() (string, error)
+	// CheckToken 验证消费者token是否合法，失败原因将以 Debug 级别记录到日志
 	CheckToken(token string) bool
+	// VerifyToken 同 CheckToken，返回验证失败的原因，如 ErrNotLoggedIn、ErrInvalidToken、ErrTokenExpired
+	VerifyToken(token string) error
 	// GetAllRole 获取消费者所有角色
 	GetAllRole() []Role
-	// RoleExist 检查消费者是否拥有特定角色
+	// RoleExist 检查消费者是否拥有特定角色，包含角色继承的父角色
 	RoleExist(roleName ...string) bool
-	// ResourceExist 检查消费者是否存在特定资源权限
+	// ResourceExist 检查消费者是否存在特定资源权限，角色中的资源及授权范围可使用通配符，参考 ResourceGroup.Exist
+	//
+	// 所有资源需由同一个角色（包含其继承的父角色）授予，参考 Role.Exist；任意角色命中拒绝资源或超出授权范围时视为不存在
 	ResourceExist(resourceUri ...string) bool
+	// Decide 获取消费者对资源的鉴权决策，包含作出决策的角色及资源组
+	Decide(resourceUri string) Decision
+	// Authorize 检查消费者是否存在特定资源权限，不存在时返回 ErrForbidden
+	//
+	// 与 ResourceExist 不同，每条资源分别通过 Decide 作出决策，可由不同的角色授予
+	Authorize(resourceUri ...string) error
 	// Store 存储数据到该消费者
 	Store(key string, value interface{}) error
 	// Load 加载存储到数据
@@ -47,28 +61,32 @@ func newConsumer(auth Auth, tag string, clientTag string) *consumer {
 }
 
 type consumer struct {
-	sync.Mutex // 只有setRole会发生写操作，避免验证权限时改写，将其进行加锁
-	auth       Auth
-	Tag        string // 消费者标记，可以是用户名等具有唯一性等内容。
-	ClientTag  string // 包含客户端标记的消费标记
-	FullTag    string // 完整到标签
-	Roles      []Role // 消费者拥有的角色
+	sync.RWMutex // 只有setRole会发生写操作，策略热重载等后台任务可能与权限验证并发，读取角色时需加读锁
+	auth         Auth
+	Tag          string   // 消费者标记，可以是用户名等具有唯一性等内容。
+	ClientTag    string   // 包含客户端标记的消费标记
+	FullTag      string   // 完整到标签
+	Roles        []Role   // 消费者拥有的角色
+	Scopes       []string // 授权范围（资源URI），为空时不额外限制，用于API密钥消费者
+	Device       Device   // 登录时的设备信息
+
+	scopeMatcher *resourceMatcher // 由 Scopes 编译的匹配器
 }
 
 func (slf *consumer) RoleExist(roleName ...string) bool {
-	var count = 0
-	var match = len(roleName)
-	for _, r := range slf.Roles {
-		for _, s := range roleName {
-			if r.GetName() == s {
-				count++
-				if count == match {
-					return true
-				}
-			}
+	if len(roleName) == 0 {
+		return false
+	}
+	var names = map[string]bool{}
+	for _, r := range lineage(slf.roles()) {
+		names[r.GetName()] = true
+	}
+	for _, s := range roleName {
+		if !names[s] {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 func (slf *consumer) Store(key string, value interface{}) error {
@@ -76,7 +94,7 @@ func (slf *consumer) Store(key string, value interface{}) error {
 	if err != nil {
 		return err
 	}
-	return session.Store(key, value)
+	return wrapError(ErrStore, session.Store(key, value))
 }
 
 func (slf *consumer) Load(key string) (interface{}, error) {
@@ -85,7 +103,11 @@ func (slf *consumer) Load(key string) (interface{}, error) {
 		return nil, err
 	}
 
-	return session.Load(key)
+	value, err := session.Load(key)
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	return value, nil
 }
 
 func (slf *consumer) Del(key string) error {
@@ -93,19 +115,27 @@ func (slf *consumer) Del(key string) error {
 	if err != nil {
 		return err
 	}
-	return session.Del(key)
+	return wrapError(ErrStore, session.Del(key))
 }
 
 func (slf *consumer) GetAllRole() []Role {
 	var roles []Role
-	for _, r := range slf.Roles {
+	for _, r := range slf.roles() {
 		roles = append(roles, r)
 	}
 	return roles
 }
 
 func (slf *consumer) ResourceExist(resourceUri ...string) bool {
-	for _, r := range slf.Roles {
+	if len(resourceUri) == 0 {
+		return false
+	}
+	for _, uri := range resourceUri {
+		if !slf.Decide(uri).Allowed {
+			return false
+		}
+	}
+	for _, r := range slf.roles() {
 		if r.Exist(resourceUri...) {
 			return true
 		}
@@ -113,12 +143,62 @@ func (slf *consumer) ResourceExist(resourceUri ...string) bool {
 	return false
 }
 
+func (slf *consumer) Decide(resourceUri string) Decision {
+	if slf.scopeMatcher != nil {
+		if _, inScope := slf.scopeMatcher.match(resourceUri); !inScope {
+			return Decision{Uri: resourceUri, OutScope: true}
+		}
+	}
+	return decide(slf.roles(), resourceUri)
+}
+
+func (slf *consumer) Authorize(resourceUri ...string) error {
+	var missing, denied []string
+	for _, uri := range resourceUri {
+		decision := slf.Decide(uri)
+		switch {
+		case decision.Allowed:
+		case decision.Resource != nil:
+			denied = append(denied, uri+" (denied by "+decision.Role+"/"+decision.Group+")")
+		default:
+			missing = append(missing, uri)
+		}
+	}
+	if len(denied) > 0 {
+		return newError(ErrForbidden, "denied resource permission: "+strings.Join(append(denied, missing...), ", "))
+	}
+	if len(missing) > 0 || len(resourceUri) == 0 {
+		return newError(ErrForbidden, "missing resource permission: "+strings.Join(resourceUri, ", "))
+	}
+	return nil
+}
+
+// 设置授权范围并编译匹配器，需在消费者构建时调用
+func (slf *consumer) setScopes(scopes []string) {
+	slf.Scopes = scopes
+	slf.scopeMatcher = nil
+	if len(scopes) == 0 {
+		return
+	}
+	slf.scopeMatcher = newResourceMatcher()
+	for i, scope := range scopes {
+		slf.scopeMatcher.add(scope, i)
+	}
+}
+
 func (slf *consumer) setRole(roles ...Role) {
 	slf.Lock()
 	slf.Roles = roles
 	slf.Unlock()
 }
 
+// 获取当前角色，setRole 只会整体替换角色切片，返回的切片可在锁外安全读取
+func (slf *consumer) roles() []Role {
+	slf.RLock()
+	defer slf.RUnlock()
+	return slf.Roles
+}
+
 func (slf *consumer) GetUsername() string {
 	return slf.Tag
 }
@@ -128,35 +208,38 @@ func (slf *consumer) getClientTag() string {
 }
 
 func (slf *consumer) CheckToken(token string) bool {
-	var (
-		err       error
-		slfToken  string
-		slfSource []byte
-		check     []byte
-	)
-
-	slfToken, err = slf.GetToken()
-	if err != nil {
-		fmt.Println("check token failed. err: ", err)
+	if err := slf.VerifyToken(token); err != nil {
+		slf.auth.getLogger().Debug("check token failed", logKeyConsumer, slf.GetTag(), logKeyClient, slf.ClientTag, logKeyError, err)
 		return false
 	}
-	slfSource, err = slf.auth.getRsa().RsaDecrypt([]byte(slfToken))
+	return true
+}
+
+func (slf *consumer) VerifyToken(token string) error {
+	slfToken, err := slf.GetToken()
 	if err != nil {
-		fmt.Println("check token failed. err: ", err)
-		return false
+		return sessionError(err)
 	}
-
-	check, err = slf.auth.getRsa().RsaDecrypt([]byte(token))
+	slfClaims, err := slf.auth.ParseToken(slfToken)
 	if err != nil {
-		fmt.Println("check token failed. err: ", err)
-		return false
+		return err
 	}
-
-	return string(slfSource) == string(check)
+	checkClaim, err := slf.auth.ParseToken(token)
+	if err != nil {
+		return err
+	}
+	if slfClaims.SessionID != checkClaim.SessionID {
+		return newError(ErrInvalidToken, "token belongs to another session")
+	}
+	return nil
 }
 
 func (slf *consumer) OutLogin() error {
-	return slf.auth.Ban(slf)
+	return slf.auth.ban(slf, EventLoggedOut, slf.GetUsername())
+}
+
+func (slf *consumer) GetDevice() Device {
+	return slf.Device
 }
 
 func (slf *consumer) GetTag() string {
@@ -167,10 +250,18 @@ func (slf *consumer) GetToken() (string, error) {
 	if s, err := slf.auth.getSession(slf); err != nil {
 		return "", err
 	} else {
-		if token, err := s.Load("token"); err != nil {
+		if token, err := s.Load(sessionKeyToken); err != nil {
 			return "", err
 		} else {
 			return token.(string), nil
 		}
 	}
 }
+
+func (slf *consumer) GetRefreshToken() (string, error) {
+	s, err := slf.auth.getSession(slf)
+	if err != nil {
+		return "", err
+	}
+	return loadString(s, sessionKeyRefreshToken)
+}
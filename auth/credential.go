@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	passwordSaltSize = 16 // 密码哈希盐长度
+	passwordKeySize  = 32 // 密码哈希长度
+)
+
+// PHC格式中盐及哈希使用的编码
+var phcEncoding = base64.RawStdEncoding
+
+// PasswordHasher 密码哈希器，生成自描述的PHC格式哈希
+type PasswordHasher interface {
+	// Hash 生成密码哈希
+	Hash(password string) (string, error)
+	// NeedsRehash 检查哈希使用的算法或参数是否与当前哈希器不一致，不一致时应在验证通过后重新生成哈希
+	NeedsRehash(encoded string) bool
+}
+
+// CredentialStore 账号密码哈希存储
+type CredentialStore interface {
+	// Get 获取用户的密码哈希，用户不存在时应返回 ErrInvalidCredentials 类型的错误，其余错误将视为存储不可用（ErrStore）
+	Get(username string) (string, error)
+	// Set 设置用户的密码哈希
+	Set(username string, encoded string) error
+}
+
+// WithCredentialStore 使用特定的账号密码哈希存储，AddTempAccount 添加的账号将存储于此，默认存储于内存中
+func WithCredentialStore(store CredentialStore) Option {
+	return func(auth *auth) error {
+		auth.credentials = store
+		return nil
+	}
+}
+
+// WithPasswordHasher 使用特定的密码哈希器，默认使用 argon2id
+//
+// 更换哈希器或调整参数后，旧哈希仍可验证，并将在用户下一次登录成功后自动以新的参数重新生成
+func WithPasswordHasher(hasher PasswordHasher) Option {
+	return func(auth *auth) error {
+		auth.hasher = hasher
+		return nil
+	}
+}
+
+// NewMemoryCredentialStore 创建一个基于内存的账号密码哈希存储
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		hashes: map[string]string{},
+	}
+}
+
+// MemoryCredentialStore 基于内存的账号密码哈希存储
+type MemoryCredentialStore struct {
+	sync.RWMutex
+	hashes map[string]string
+}
+
+// Get 获取用户的密码哈希
+func (slf *MemoryCredentialStore) Get(username string) (string, error) {
+	slf.RLock()
+	defer slf.RUnlock()
+	encoded, exist := slf.hashes[username]
+	if !exist {
+		return "", newError(ErrInvalidCredentials, "account does not exist")
+	}
+	return encoded, nil
+}
+
+// Set 设置用户的密码哈希
+func (slf *MemoryCredentialStore) Set(username string, encoded string) error {
+	slf.Lock()
+	slf.hashes[username] = encoded
+	slf.Unlock()
+	return nil
+}
+
+// LoadFile 从文件中载入账号密码哈希
+//
+// 文件每行格式为 用户名:PHC格式哈希，空行及以 # 开头的行将被忽略
+func (slf *MemoryCredentialStore) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		index := strings.Index(text, ":")
+		if index <= 0 {
+			return fmt.Errorf("%s:%d: expect username:hash", path, line)
+		}
+		username, encoded := text[:index], text[index+1:]
+		if _, err = parsePasswordHash(encoded); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		hashes[username] = encoded
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	slf.Lock()
+	for username, encoded := range hashes {
+		slf.hashes[username] = encoded
+	}
+	slf.Unlock()
+	return nil
+}
+
+// NewBcryptHasher 创建一个 bcrypt 密码哈希器，cost 小于等于 0 时使用 bcrypt.DefaultCost
+func NewBcryptHasher(cost int) PasswordHasher {
+	if cost <= 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptHasher{cost: cost}
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (slf *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), slf.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (slf *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != slf.cost
+}
+
+// NewArgon2idHasher 创建一个 argon2id 密码哈希器
+//
+// memory 为内存开销（KiB），iterations 为迭代次数，parallelism 为并行度，为 0 时使用默认参数 m=19456,t=2,p=1
+func NewArgon2idHasher(memory uint32, iterations uint32, parallelism uint8) PasswordHasher {
+	if memory == 0 {
+		memory = 19456
+	}
+	if iterations == 0 {
+		iterations = 2
+	}
+	if parallelism == 0 {
+		parallelism = 1
+	}
+	return &argon2idHasher{memory: memory, iterations: iterations, parallelism: parallelism}
+}
+
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func (slf *argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newPasswordSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, slf.iterations, slf.memory, slf.parallelism, passwordKeySize)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, slf.memory, slf.iterations, slf.parallelism,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (slf *argon2idHasher) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.id != "argon2id" || phc.version != argon2.Version {
+		return true
+	}
+	return phc.params["m"] != int(slf.memory) || phc.params["t"] != int(slf.iterations) || phc.params["p"] != int(slf.parallelism)
+}
+
+// NewScryptHasher 创建一个 scrypt 密码哈希器
+//
+// ln 为 CPU/内存开销 N 的以2为底的对数，r 为块大小，p 为并行度，为 0 时使用默认参数 ln=15,r=8,p=1
+func NewScryptHasher(ln int, r int, p int) PasswordHasher {
+	if ln <= 0 {
+		ln = 15
+	}
+	if r <= 0 {
+		r = 8
+	}
+	if p <= 0 {
+		p = 1
+	}
+	return &scryptHasher{ln: ln, r: r, p: p}
+}
+
+type scryptHasher struct {
+	ln int
+	r  int
+	p  int
+}
+
+func (slf *scryptHasher) Hash(password string) (string, error) {
+	salt, err := newPasswordSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<slf.ln, slf.r, slf.p, passwordKeySize)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", slf.ln, slf.r, slf.p,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (slf *scryptHasher) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.id != "scrypt" {
+		return true
+	}
+	return phc.params["ln"] != slf.ln || phc.params["r"] != slf.r || phc.params["p"] != slf.p
+}
+
+// VerifyPassword 以常量时间校验密码与哈希是否匹配，支持 bcrypt 及 PHC 格式的 argon2id、scrypt 哈希
+//
+// 密码不匹配时返回 false 及空错误，哈希格式无法识别时返回错误
+func VerifyPassword(encoded string, password string) (bool, error) {
+	phc, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	var key []byte
+	switch phc.id {
+	case "bcrypt":
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	case "argon2id":
+		key = argon2.IDKey([]byte(password), phc.salt, uint32(phc.params["t"]), uint32(phc.params["m"]), uint8(phc.params["p"]), uint32(len(phc.hash)))
+	case "scrypt":
+		if key, err = scrypt.Key([]byte(password), phc.salt, 1<<phc.params["ln"], phc.params["r"], phc.params["p"], len(phc.hash)); err != nil {
+			return false, err
+		}
+	}
+	return subtle.ConstantTimeCompare(key, phc.hash) == 1, nil
+}
+
+// 解析并校验支持的密码哈希，bcrypt 哈希仅校验格式
+func parsePasswordHash(encoded string) (*phcHash, error) {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		if _, err := bcrypt.Cost([]byte(encoded)); err != nil {
+			return nil, err
+		}
+		return &phcHash{id: "bcrypt"}, nil
+	}
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return nil, err
+	}
+	switch phc.id {
+	case "argon2id":
+		m, t, p := phc.params["m"], phc.params["t"], phc.params["p"]
+		if phc.version != argon2.Version || m <= 0 || t <= 0 || p <= 0 || p > 255 {
+			return nil, errors.New("invalid argon2id hash parameters")
+		}
+	case "scrypt":
+		ln, r, p := phc.params["ln"], phc.params["r"], phc.params["p"]
+		if ln <= 0 || ln >= 32 || r <= 0 || p <= 0 {
+			return nil, errors.New("invalid scrypt hash parameters")
+		}
+	default:
+		return nil, errors.New("unsupported password hash algorithm: " + phc.id)
+	}
+	return phc, nil
+}
+
+// PHC格式哈希
+type phcHash struct {
+	id      string         // 算法
+	version int            // 算法版本
+	params  map[string]int // 算法参数
+	salt    []byte         // 盐
+	hash    []byte         // 哈希
+}
+
+// 解析形如 $id[$v=version]$k=v,k=v$salt$hash 的PHC格式哈希
+func parsePHC(encoded string) (*phcHash, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return nil, errors.New("malformed password hash")
+	}
+	phc := &phcHash{id: fields[1], params: map[string]int{}}
+	fields = fields[2:]
+	if strings.HasPrefix(fields[0], "v=") {
+		version, err := strconv.Atoi(strings.TrimPrefix(fields[0], "v="))
+		if err != nil {
+			return nil, errors.New("malformed password hash version")
+		}
+		phc.version = version
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return nil, errors.New("malformed password hash")
+	}
+	for _, param := range strings.Split(fields[0], ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("malformed password hash parameters")
+		}
+		value, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, errors.New("malformed password hash parameters")
+		}
+		phc.params[kv[0]] = value
+	}
+	var err error
+	if phc.salt, err = phcEncoding.DecodeString(fields[1]); err != nil {
+		return nil, errors.New("malformed password hash salt")
+	}
+	if phc.hash, err = phcEncoding.DecodeString(fields[2]); err != nil || len(phc.hash) == 0 {
+		return nil, errors.New("malformed password hash")
+	}
+	return phc, nil
+}
+
+// 生成密码哈希盐
+func newPasswordSalt() ([]byte, error) {
+	var salt = make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// 校验临时账号密码，验证通过且哈希参数过期时将自动重新生成哈希
+func (slf *auth) verifyTempAccount(username string, password string) error {
+	encoded, err := slf.credentials.Get(username)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return wrapError(ErrStore, err)
+		}
+		// 用户不存在时仍计算一次哈希，避免通过响应时间探测用户是否存在
+		_, _ = slf.hasher.Hash(password)
+		return ErrInvalidCredentials
+	}
+	ok, err := VerifyPassword(encoded, password)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	if slf.hasher.NeedsRehash(encoded) {
+		if encoded, err = slf.hasher.Hash(password); err == nil {
+			_ = slf.credentials.Set(username, encoded)
+		}
+	}
+	return nil
+}
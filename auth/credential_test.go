@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	for _, hasher := range []PasswordHasher{
+		NewBcryptHasher(4),
+		NewArgon2idHasher(1024, 1, 1),
+		NewScryptHasher(10, 8, 1),
+	} {
+		encoded, err := hasher.Hash("12345")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := VerifyPassword(encoded, "12345"); err != nil || !ok {
+			t.Fatal("password should match", encoded, err)
+		}
+		if ok, err := VerifyPassword(encoded, "54321"); err != nil || ok {
+			t.Fatal("password should not match", encoded, err)
+		}
+		if hasher.NeedsRehash(encoded) {
+			t.Fatal("hash generated by the same hasher should not need rehash", encoded)
+		}
+	}
+	if _, err := VerifyPassword("12345", "12345"); err == nil {
+		t.Fatal("plaintext should not be accepted as a hash")
+	}
+}
+
+func TestAuth_CredentialRehash(t *testing.T) {
+	store := NewMemoryCredentialStore()
+	auth, err := New(session.NewManagerMemory(), WithCredentialStore(store), WithPasswordHasher(NewBcryptHasher(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	if encoded, _ := store.Get("admin"); !strings.HasPrefix(encoded, "$2a$04$") {
+		t.Fatal("unexpected hash", encoded)
+	}
+
+	// 更换哈希器后登录成功将自动重新生成哈希
+	auth, err = New(session.NewManagerMemory(), WithCredentialStore(store), WithPasswordHasher(NewArgon2idHasher(1024, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().Password("admin", "54321"); err == nil {
+		t.Fatal("wrong password should be rejected")
+	}
+	if encoded, _ := store.Get("admin"); !strings.HasPrefix(encoded, "$2a$") {
+		t.Fatal("hash should not be changed by a failed login", encoded)
+	}
+	if _, err = auth.Login().Password("admin", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := store.Get("admin"); !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatal("hash should be upgraded", encoded)
+	}
+}
+
+type failedCredentialStore struct {
+	*MemoryCredentialStore
+}
+
+func (failedCredentialStore) Get(username string) (string, error) {
+	return "", errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+}
+
+func TestAuth_CredentialStoreFailure(t *testing.T) {
+	auth, err := New(session.NewManagerMemory(), WithCredentialStore(failedCredentialStore{NewMemoryCredentialStore()}), WithLockout(LockoutOptions{
+		FreeAttempts: 1,
+		MaxAttempts:  2,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 存储不可用不视为密码错误，也不计入失败次数
+	for i := 0; i < 3; i++ {
+		if _, err = auth.Login().Password("admin", "12345"); !errors.Is(err, ErrStore) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("expect store error, got", err)
+		}
+	}
+	memory, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = memory.Login().Password("nobody", "12345"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal("expect invalid credentials, got", err)
+	}
+}
+
+func TestMemoryCredentialStore_LoadFile(t *testing.T) {
+	encoded, err := NewScryptHasher(10, 8, 1).Hash("12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "accounts")
+	if err = os.WriteFile(path, []byte("# 测试账号\n\nadmin:"+encoded+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryCredentialStore()
+	if err = store.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := New(session.NewManagerMemory(), WithCredentialStore(store), WithPasswordHasher(NewScryptHasher(10, 8, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().Password("admin", "12345"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(path, []byte("admin:12345\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.LoadFile(path); err == nil {
+		t.Fatal("plaintext password in file should be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+// Decision 资源鉴权决策
+type Decision struct {
+	Allowed  bool     // 是否允许访问
+	Uri      string   // 请求的资源uri
+	Role     string   // 作出决策的角色名称，资源继承自父角色时为父角色，无任何资源匹配或超出授权范围时为空
+	Group    string   // 作出决策的资源组名称
+	Resource Resource // 作出决策的资源，即命中的允许资源或拒绝资源
+	OutScope bool     // 是否因超出消费者授权范围而拒绝
+}
+
+// 按拒绝优先的规则在多个角色中作出决策
+//
+// 任意角色（包含继承的父角色）的任意资源组命中拒绝资源时拒绝，否则由首个命中允许资源的角色及资源组授予，均未命中时拒绝
+func decide(roles []Role, resourceUri string) Decision {
+	var decision = Decision{Uri: resourceUri}
+	for _, r := range lineage(roles) {
+		for _, group := range r.GetAllResourceGroup() {
+			allow, deny := decideGroup(group, resourceUri)
+			if deny != nil {
+				return Decision{
+					Uri:      resourceUri,
+					Role:     r.GetName(),
+					Group:    group.GetName(),
+					Resource: deny,
+				}
+			}
+			if allow != nil && !decision.Allowed {
+				decision = Decision{
+					Allowed:  true,
+					Uri:      resourceUri,
+					Role:     r.GetName(),
+					Group:    group.GetName(),
+					Resource: allow,
+				}
+			}
+		}
+	}
+	return decision
+}
+
+// 可一次性得出允许资源及拒绝资源的资源组，内置资源组通过通配匹配器实现
+type resourceDecider interface {
+	decide(resourceUri string) (allow Resource, deny Resource)
+}
+
+// 获取资源组中与uri匹配的允许资源及拒绝资源，未匹配时为nil
+//
+// 外部实现的资源组通过 Match 获取最具体的资源，并根据资源组及资源是否为拒绝资源作出判定
+func decideGroup(group ResourceGroup, resourceUri string) (allow Resource, deny Resource) {
+	if decider, ok := group.(resourceDecider); ok {
+		return decider.decide(resourceUri)
+	}
+	r, exist := group.Match(resourceUri)
+	if !exist {
+		return nil, nil
+	}
+	if group.IsDeny() || r.IsDeny() {
+		return nil, r
+	}
+	return r, nil
+}
+
+// 获取多个角色及其所有祖先角色，按深度优先排列且按名称去重
+func lineage(roles []Role) []Role {
+	var result []Role
+	var visited = map[string]bool{}
+	var walk func(r Role)
+	walk = func(r Role) {
+		if visited[r.GetName()] {
+			return
+		}
+		visited[r.GetName()] = true
+		result = append(result, r)
+		for _, parent := range r.GetParents() {
+			walk(parent)
+		}
+	}
+	for _, r := range roles {
+		walk(r)
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConsumer_Decide(t *testing.T) {
+	helper := &RoleHelper{}
+	admin := helper.NewRole("admin").
+		AddResourceGroup(helper.NewResourceGroup("all").
+			Add(helper.NewResource("everything", "**")).
+			Add(helper.NewDenyResource("billing", "*:/api/billing/**")))
+	auditor := helper.NewRole("auditor").
+		AddResourceGroup(helper.NewResourceGroup("audit").
+			Add(helper.NewResource("read audit", "get:/api/audit/**"))).
+		AddResourceGroup(helper.NewDenyResourceGroup("sensitive").
+			Add(helper.NewResource("audit export", "get:/api/audit/export")))
+
+	consumer := newConsumer(nil, "admin", "")
+	consumer.setRole(admin, auditor)
+
+	decision := consumer.Decide("get:/api/user/1")
+	if !decision.Allowed || decision.Role != "admin" || decision.Group != "all" || decision.Resource.GetName() != "everything" {
+		t.Fatal("unexpected decision", decision)
+	}
+	decision = consumer.Decide("post:/api/billing/invoice")
+	if decision.Allowed || decision.Role != "admin" || decision.Resource.GetName() != "billing" {
+		t.Fatal("billing should be denied by admin", decision)
+	}
+	// 拒绝资源优先于其他角色授予的资源
+	decision = consumer.Decide("get:/api/audit/export")
+	if decision.Allowed || decision.Role != "auditor" || decision.Group != "sensitive" {
+		t.Fatal("audit export should be denied by auditor", decision)
+	}
+	if !consumer.ResourceExist("get:/api/user/1", "get:/api/audit/log") || consumer.ResourceExist("get:/api/user/1", "get:/api/billing") {
+		t.Fatal("resource exist mismatch")
+	}
+	if admin.Exist("get:/api/billing") || !auditor.Exist("get:/api/audit/log") || auditor.Exist("get:/api/audit/export") {
+		t.Fatal("role exist mismatch")
+	}
+
+	// ResourceExist 要求所有资源由同一个角色授予，Authorize 可由不同角色分别授予
+	reader := helper.NewRole("reader").
+		AddResourceGroup(helper.NewResourceGroup("read").Add(helper.NewResource("read", "get:/api/doc")))
+	writer := helper.NewRole("writer").
+		AddResourceGroup(helper.NewResourceGroup("write").Add(helper.NewResource("write", "post:/api/doc")))
+	editor := newConsumer(nil, "editor", "")
+	editor.setRole(reader, writer)
+	if !editor.ResourceExist("get:/api/doc") || !editor.ResourceExist("post:/api/doc") || editor.ResourceExist("get:/api/doc", "post:/api/doc") {
+		t.Fatal("resource exist should require a single role")
+	}
+	if err := editor.Authorize("get:/api/doc", "post:/api/doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := consumer.Authorize("get:/api/billing")
+	if !errors.Is(err, ErrForbidden) || !strings.Contains(err.Error(), "denied by admin/all") {
+		t.Fatal("unexpected authorize error", err)
+	}
+
+	consumer.setScopes([]string{"get:/api/user/*"})
+	if decision = consumer.Decide("get:/api/audit/log"); decision.Allowed || !decision.OutScope {
+		t.Fatal("out of scope resource should be denied", decision)
+	}
+}
+
+// 外部实现的资源组，仅支持完全匹配
+type externalResourceGroup struct {
+	name      string
+	deny      bool
+	resources []Resource
+}
+
+func (slf *externalResourceGroup) GetName() string { return slf.name }
+
+func (slf *externalResourceGroup) GetResourceCount() int { return len(slf.resources) }
+
+func (slf *externalResourceGroup) GetAllResource() []Resource { return slf.resources }
+
+func (slf *externalResourceGroup) Add(resource ...Resource) ResourceGroup {
+	slf.resources = append(slf.resources, resource...)
+	return slf
+}
+
+func (slf *externalResourceGroup) Exist(resourceUri string) bool {
+	r, exist := slf.Match(resourceUri)
+	return exist && !slf.deny && !r.IsDeny()
+}
+
+func (slf *externalResourceGroup) Match(resourceUri string) (Resource, bool) {
+	for _, r := range slf.resources {
+		if r.GetURI() == resourceUri {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (slf *externalResourceGroup) GetResource(uri string) Resource {
+	r, _ := slf.Match(uri)
+	return r
+}
+
+func (slf *externalResourceGroup) IsDeny() bool { return slf.deny }
+
+// 外部实现的角色
+type externalRole struct {
+	name    string
+	groups  []ResourceGroup
+	parents []Role
+}
+
+func (slf *externalRole) GetName() string { return slf.name }
+
+func (slf *externalRole) GetAllResourceGroup() []ResourceGroup { return slf.groups }
+
+func (slf *externalRole) GetAllResource() []Resource { return nil }
+
+func (slf *externalRole) Exist(resourceUri ...string) bool { return false }
+
+func (slf *externalRole) AddResourceGroup(resourceGroup ...ResourceGroup) Role {
+	slf.groups = append(slf.groups, resourceGroup...)
+	return slf
+}
+
+func (slf *externalRole) Inherit(parents ...Role) error {
+	slf.parents = append(slf.parents, parents...)
+	return nil
+}
+
+func (slf *externalRole) GetParents() []Role { return slf.parents }
+
+func TestConsumer_DecideExternal(t *testing.T) {
+	helper := &RoleHelper{}
+	parent := &externalRole{name: "parent"}
+	parent.AddResourceGroup(&externalResourceGroup{name: "denied", deny: true, resources: []Resource{helper.NewResource("secret", "get:/secret")}})
+	child := &externalRole{name: "child"}
+	child.AddResourceGroup((&externalResourceGroup{name: "docs"}).Add(helper.NewResource("docs", "get:/docs"), helper.NewResource("secret", "get:/secret")))
+	_ = child.Inherit(parent)
+
+	// 外部实现的角色及资源组同样参与决策，父角色的拒绝资源组生效
+	consumer := newConsumer(nil, "admin", "")
+	consumer.setRole(child)
+	if decision := consumer.Decide("get:/docs"); !decision.Allowed || decision.Role != "child" || decision.Group != "docs" {
+		t.Fatal("unexpected decision", decision)
+	}
+	if decision := consumer.Decide("get:/secret"); decision.Allowed || decision.Role != "parent" || decision.Group != "denied" {
+		t.Fatal("secret should be denied by parent", decision)
+	}
+
+	// 内置角色可继承外部实现的角色
+	builtin := helper.NewRole("builtin")
+	if err := builtin.Inherit(child); err != nil {
+		t.Fatal(err)
+	}
+	if !builtin.Exist("get:/docs") || builtin.Exist("get:/secret") {
+		t.Fatal("builtin role should inherit external resources")
+	}
+}
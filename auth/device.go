@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	sessionKeyLastSeen = "last_seen"     // 消费者会话中的最后活跃时间
+	lastSeenInterval   = 1 * time.Minute // 最后活跃时间的最小更新间隔，避免每次请求都写入会话管理器
+
+	userSessionsPrefix = "__x_x__user_sessions:" // 用户会话索引会话id前缀
+	indexKeySessions   = "sessions"              // 用户会话索引中的会话id列表（JSON数组）
+)
+
+// Device 消费者登录时的设备信息
+type Device struct {
+	ClientType string    // 客户端类型，如 web、ios、android
+	UserAgent  string    // 客户端 User-Agent
+	IP         string    // 登录时的来源IP
+	LoginAt    time.Time // 登录时间
+	LastSeenAt time.Time // 最后活跃时间，通过令牌获取消费者时写入会话（每分钟最多一次），需通过 Auth.ListSessions 获取最新值
+}
+
+// SessionInfo 用户的一个已登录会话
+type SessionInfo struct {
+	SessionID string // 会话id，即消费者的完整标记，可用于 Auth.RevokeSession
+	Device    Device // 设备信息
+}
+
+func (slf *auth) ListSessions(username string) ([]SessionInfo, error) {
+	var sessions []SessionInfo
+	for _, sessionId := range slf.indexedSessions(username) {
+		c, err := slf.GetConsumer(sessionId)
+		if err != nil {
+			if errors.Is(err, ErrNotLoggedIn) {
+				continue
+			}
+			return nil, err
+		}
+		if c.GetUsername() != username {
+			continue
+		}
+		device := c.GetDevice()
+		if ses, err := slf.getSession(c); err == nil {
+			if lastSeen, err := loadString(ses, sessionKeyLastSeen); err == nil {
+				if unix, err := strconv.ParseInt(lastSeen, 10, 64); err == nil {
+					device.LastSeenAt = time.Unix(unix, 0)
+				}
+			}
+		}
+		sessions = append(sessions, SessionInfo{
+			SessionID: c.GetTag(),
+			Device:    device,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Device.LoginAt.Before(sessions[j].Device.LoginAt)
+	})
+	return sessions, nil
+}
+
+func (slf *auth) RevokeSession(username string, sessionId string) error {
+	return slf.revokeSession(username, sessionId, EventBanned, username)
+}
+
+// 踢出用户的特定会话并触发特定类型的事件，actor 为发起操作的用户
+func (slf *auth) revokeSession(username string, sessionId string, eventType EventType, actor string) error {
+	c, err := slf.GetConsumer(sessionId)
+	if err != nil {
+		return err
+	}
+	if c.GetUsername() != username {
+		return newError(ErrNotLoggedIn, "session does not exist")
+	}
+	return slf.ban(c, eventType, actor)
+}
+
+// 更新消费者的最后活跃时间
+func (slf *auth) touch(consumer Consumer) error {
+	ses, err := slf.getSession(consumer)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if lastSeen, err := loadString(ses, sessionKeyLastSeen); err == nil {
+		if unix, err := strconv.ParseInt(lastSeen, 10, 64); err == nil && now.Sub(time.Unix(unix, 0)) < lastSeenInterval {
+			return nil
+		}
+	}
+	return wrapError(ErrStore, ses.Store(sessionKeyLastSeen, strconv.FormatInt(now.Unix(), 10)))
+}
+
+// 获取用户会话索引中的会话id，其中可能包含已过期的会话
+func (slf *auth) indexedSessions(username string) []string {
+	index, err := slf.sm.GetSession(userSessionsPrefix + username)
+	if err != nil {
+		return nil
+	}
+	data, err := loadString(index, indexKeySessions)
+	if err != nil {
+		return nil
+	}
+	var sessionIds []string
+	_ = json.Unmarshal([]byte(data), &sessionIds)
+	return sessionIds
+}
+
+// 更新用户会话索引，加入 added 并移除 removed 及已失效的会话
+//
+// 索引会话将被重新注册，使其过期时间不早于其中任何一个会话
+func (slf *auth) updateSessionIndex(username string, added string, removed ...string) error {
+	unlock := slf.indexLocks.Lock(username)
+	defer unlock()
+
+	var skip = map[string]bool{added: true}
+	for _, sessionId := range removed {
+		skip[sessionId] = true
+	}
+	var sessionIds []string
+	for _, sessionId := range slf.indexedSessions(username) {
+		if skip[sessionId] {
+			continue
+		}
+		if _, err := slf.sm.GetSession(sessionId); err != nil {
+			continue
+		}
+		sessionIds = append(sessionIds, sessionId)
+	}
+	if added != "" {
+		sessionIds = append(sessionIds, added)
+	}
+
+	if index, err := slf.sm.GetSession(userSessionsPrefix + username); err == nil {
+		if err = slf.sm.UnRegisterSession(index); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+	if len(sessionIds) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(sessionIds)
+	if err != nil {
+		return err
+	}
+	index, err := slf.sm.RegisterSession(userSessionsPrefix + username)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	return wrapError(ErrStore, index.Store(indexKeySessions, string(data)))
+}
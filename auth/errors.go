@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCredentials 账号不存在或密码、验证码、API密钥等凭证错误
+	ErrInvalidCredentials = errors.New("the account does not exist or the login password is wrong")
+	// ErrNotLoggedIn 消费者未登录或登录已失效
+	ErrNotLoggedIn = errors.New("consumer is not logged in")
+	// ErrInvalidToken 令牌无法解析、签名错误或已被替换、吊销
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired 令牌已过期
+	ErrTokenExpired = errors.New("token has expired")
+	// ErrForbidden 消费者不具备访问特定资源的权限
+	ErrForbidden = errors.New("permission denied")
+	// ErrStore 会话管理器或凭证存储等后端不可用
+	ErrStore = errors.New("auth store is unavailable")
+
+	// ErrMFARequired 需要完成二次验证，可通过 errors.As 获取 *MFARequiredError 中的挑战id
+	ErrMFARequired = errors.New("multi-factor authentication required")
+	// ErrAccountLocked 账号或来源IP因多次登录失败被暂时锁定，可通过 errors.As 获取 *AccountLockedError 中的解锁时间
+	ErrAccountLocked = errors.New("account is temporarily locked due to too many failed login attempts")
+	// ErrTooManyClients 用户登录的客户端数量达到 SetMaxClients 设置的上限
+	ErrTooManyClients = errors.New("too many clients are logged in")
+	// ErrVetoed 操作被 Auth.Hook 设置的钩子拒绝，可通过 errors.Unwrap 获取钩子返回的错误
+	ErrVetoed = errors.New("operation vetoed by hook")
+	// ErrRoleCycle 角色继承关系形成环
+	ErrRoleCycle = errors.New("role inheritance cycle")
+	// ErrNotEnabled 使用的登录模式或功能未在创建认证器时启用，如未通过 WithCodeSender、WithMFA、WithRefreshToken 启用
+	ErrNotEnabled = errors.New("feature is not enabled")
+	// ErrCodeCooldown 验证码已发送且仍在重新发送的冷却时间内
+	ErrCodeCooldown = errors.New("code has been sent, please try again later")
+)
+
+// Error 携带具体原因的错误，可通过 errors.Is 判断其类型（如 ErrInvalidToken），通过 errors.Unwrap 获取原因
+type Error struct {
+	Kind  error // 错误类型，为本包定义的 Err 开头的错误之一
+	Cause error // 具体原因
+}
+
+func (slf *Error) Error() string {
+	if slf.Cause == nil {
+		return slf.Kind.Error()
+	}
+	return slf.Kind.Error() + ": " + slf.Cause.Error()
+}
+
+// Is 使其可通过 errors.Is(err, slf.Kind) 判断
+func (slf *Error) Is(target error) bool {
+	return target == slf.Kind
+}
+
+func (slf *Error) Unwrap() error {
+	return slf.Cause
+}
+
+// MFARequiredError 密码或验证码验证通过但需要完成二次验证时返回的错误
+type MFARequiredError struct {
+	ChallengeID string // 挑战id，需通过 LoginModeSelector.TOTP 完成登录
+}
+
+func (slf *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+// Is 使其可通过 errors.Is(err, ErrMFARequired) 判断
+func (slf *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// AccountLockedError 账号或来源IP被暂时锁定时返回的错误
+type AccountLockedError struct {
+	Until time.Time // 自动解锁时间
+}
+
+func (slf *AccountLockedError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+// Is 使其可通过 errors.Is(err, ErrAccountLocked) 判断
+func (slf *AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// 以特定类型包装错误原因，原因已是本包定义的类型时保持不变
+func wrapError(kind error, cause error) error {
+	if cause == nil || isAuthError(cause) {
+		return cause
+	}
+	return &Error{Kind: kind, Cause: cause}
+}
+
+// 以特定类型及原因描述创建错误
+func newError(kind error, cause string) error {
+	return &Error{Kind: kind, Cause: errors.New(cause)}
+}
+
+// 检查错误是否已是本包定义的类型
+func isAuthError(err error) bool {
+	for _, kind := range []error{ErrInvalidCredentials, ErrNotLoggedIn, ErrInvalidToken, ErrTokenExpired, ErrForbidden, ErrStore, ErrMFARequired, ErrAccountLocked, ErrTooManyClients, ErrVetoed, ErrRoleCycle, ErrNotEnabled, ErrCodeCooldown} {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// 将会话管理器返回的错误归类为 ErrNotLoggedIn 或 ErrStore
+//
+// 会话管理器未导出错误值，会话不存在或已过期只能通过错误描述识别
+func sessionError(err error) error {
+	if err == nil || isAuthError(err) {
+		return err
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "expired") {
+		return &Error{Kind: ErrNotLoggedIn, Cause: err}
+	}
+	return &Error{Kind: ErrStore, Cause: err}
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// EventType 认证事件类型
+type EventType int
+
+const (
+	// EventLoginSucceeded 登录成功，钩子在创建会话前执行，返回错误时拒绝登录
+	EventLoginSucceeded EventType = iota + 1
+	// EventLoginFailed 登录失败，仅用于通知，钩子返回的错误将被忽略
+	EventLoginFailed
+	// EventLoggedOut 消费者主动退出登录，钩子在注销会话前执行，返回错误时拒绝退出
+	EventLoggedOut
+	// EventBanned 消费者被踢出，钩子在注销会话前执行，返回错误时拒绝踢出
+	EventBanned
+	// EventEvicted 消费者因客户端数量达到上限被踢出，钩子在注销该会话及创建新会话前执行，返回错误时保留该会话并以 ErrVetoed 拒绝新的登录
+	EventEvicted
+	// EventTokenRefreshed 使用刷新令牌轮换了访问令牌，钩子在签发新令牌前执行，返回错误时拒绝刷新
+	EventTokenRefreshed
+	// EventRolesRefreshed 已登录消费者的角色被刷新，钩子在设置新角色前执行，返回错误时拒绝刷新
+	EventRolesRefreshed
+	// EventSessionExpired 会话过期，需通过 WithSessionExpiryCheck 启用，仅用于通知，钩子返回的错误将被忽略
+	EventSessionExpired
+)
+
+const eventBufferSize = 256 // 订阅者的事件缓冲区大小，缓冲区已满时将丢弃事件并记录警告日志，避免阻塞认证流程
+
+var eventTypeNames = map[EventType]string{
+	EventLoginSucceeded: "login_succeeded",
+	EventLoginFailed:    "login_failed",
+	EventLoggedOut:      "logged_out",
+	EventBanned:         "banned",
+	EventEvicted:        "evicted",
+	EventTokenRefreshed: "token_refreshed",
+	EventRolesRefreshed: "roles_refreshed",
+	EventSessionExpired: "session_expired",
+}
+
+func (slf EventType) String() string {
+	if name, exist := eventTypeNames[slf]; exist {
+		return name
+	}
+	return "unknown"
+}
+
+// Event 认证事件
+type Event struct {
+	Type      EventType // 事件类型
+	Time      time.Time // 发生时间
+	Username  string    // 用户名
+	SessionID string    // 会话id，即消费者的完整标记，登录失败时为空
+	Device    Device    // 设备信息，登录失败时仅包含登录请求携带的信息
+	Consumer  Consumer  // 相关的消费者，登录失败及会话过期时为空
+	Roles     []Role    // EventRolesRefreshed 事件中即将设置的新角色
+	Err       error     // EventLoginFailed 事件中的失败原因
+	Actor     string    // 发起操作的用户，如 Auth.BanBy 的操作者、主动退出登录或踢出自己设备的用户，由认证器自身发起时为 ActorSystem
+}
+
+// ActorSystem 由认证器自身或未指定操作者的调用发起操作时记录的操作者，如 Auth.Ban、客户端数量限制踢出、刷新令牌重放吊销及更换角色设置函数
+const ActorSystem = "system"
+
+// 事件总线
+type eventBus struct {
+	sync.RWMutex
+	hooks       []*eventHook
+	subscribers []*eventSubscriber
+}
+
+type eventHook struct {
+	types map[EventType]bool // 关注的事件类型，为空时关注所有事件
+	hook  func(ctx context.Context, event Event) error
+}
+
+type eventSubscriber struct {
+	types  map[EventType]bool // 关注的事件类型，为空时关注所有事件
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func eventTypeSet(types []EventType) map[EventType]bool {
+	if len(types) == 0 {
+		return nil
+	}
+	set := map[EventType]bool{}
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+func (slf *auth) Hook(hook func(ctx context.Context, event Event) error, types ...EventType) func() {
+	h := &eventHook{types: eventTypeSet(types), hook: hook}
+	slf.events.Lock()
+	slf.events.hooks = append(slf.events.hooks, h)
+	slf.events.Unlock()
+	return func() {
+		slf.events.Lock()
+		defer slf.events.Unlock()
+		for i, exist := range slf.events.hooks {
+			if exist == h {
+				slf.events.hooks = append(slf.events.hooks[:i:i], slf.events.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (slf *auth) Subscribe(subscriber func(event Event), types ...EventType) func() {
+	s := &eventSubscriber{
+		types:  eventTypeSet(types),
+		events: make(chan Event, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	// 认证器关闭后不再接受订阅，Close 在持有锁时取走订阅者，因此锁内检查可保证订阅者要么被关闭、要么从未启动
+	slf.events.Lock()
+	select {
+	case <-slf.closed:
+		slf.events.Unlock()
+		return func() {}
+	default:
+	}
+	slf.events.subscribers = append(slf.events.subscribers, s)
+	slf.events.Unlock()
+	go func() {
+		for {
+			select {
+			case <-s.done:
+				return
+			case event := <-s.events:
+				subscriber(event)
+			}
+		}
+	}()
+	return func() {
+		slf.events.Lock()
+		for i, exist := range slf.events.subscribers {
+			if exist == s {
+				slf.events.subscribers = append(slf.events.subscribers[:i:i], slf.events.subscribers[i+1:]...)
+				break
+			}
+		}
+		slf.events.Unlock()
+		s.once.Do(func() {
+			close(s.done)
+		})
+	}
+}
+
+func (slf *auth) emit(ctx context.Context, event Event) error {
+	slf.events.RLock()
+	hooks := slf.events.hooks
+	slf.events.RUnlock()
+	for _, h := range hooks {
+		if h.types != nil && !h.types[event.Type] {
+			continue
+		}
+		if err := h.hook(ctx, event); err != nil {
+			return wrapError(ErrVetoed, err)
+		}
+	}
+	return nil
+}
+
+func (slf *auth) publish(event Event) {
+	slf.auditEvent(event)
+	slf.events.RLock()
+	subscribers := slf.events.subscribers
+	slf.events.RUnlock()
+	for _, s := range subscribers {
+		if s.types != nil && !s.types[event.Type] {
+			continue
+		}
+		select {
+		case s.events <- event:
+		case <-s.done:
+		default:
+			slf.getLogger().Warn("drop event, subscriber buffer is full", "type", event.Type.String(), logKeyUsername, event.Username)
+		}
+	}
+}
+
+func (slf *auth) Close() error {
+	slf.closeOnce.Do(func() {
+		close(slf.closed)
+		slf.events.Lock()
+		subscribers := slf.events.subscribers
+		slf.events.subscribers = nil
+		slf.events.Unlock()
+		for _, s := range subscribers {
+			s.once.Do(func() {
+				close(s.done)
+			})
+		}
+	})
+	return nil
+}
+
+// 执行钩子并通知订阅者，适用于仅用于通知的事件
+func (slf *auth) notify(ctx context.Context, event Event) {
+	event = newEvent(event)
+	_ = slf.emit(ctx, event)
+	slf.publish(event)
+}
+
+// 补全事件的发生时间及消费者相关信息
+func newEvent(event Event) Event {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Consumer != nil {
+		if event.Username == "" {
+			event.Username = event.Consumer.GetUsername()
+		}
+		if event.SessionID == "" {
+			event.SessionID = event.Consumer.GetTag()
+		}
+		if event.Device == (Device{}) {
+			event.Device = event.Consumer.GetDevice()
+		}
+	}
+	return event
+}
+
+// WithSessionExpiryCheck 每隔 interval 检查一次由该认证器创建的会话是否过期，过期时触发 EventSessionExpired 事件
+//
+// 仅能感知当前认证器创建的会话，其他实例踢出的会话同样视为过期
+func WithSessionExpiryCheck(interval time.Duration) Option {
+	return func(auth *auth) error {
+		if interval <= 0 {
+			return errors.New("session expiry check interval must be positive")
+		}
+		auth.expiryCheck = interval
+		auth.trackedSessions = map[string]string{}
+		return nil
+	}
+}
+
+// 记录由该认证器创建的会话
+func (slf *auth) trackSession(consumer Consumer) {
+	if slf.expiryCheck <= 0 {
+		return
+	}
+	slf.trackedLock.Lock()
+	slf.trackedSessions[consumer.GetTag()] = consumer.GetUsername()
+	slf.trackedLock.Unlock()
+}
+
+// 移除会话记录，返回会话是否被记录
+func (slf *auth) untrackSession(sessionId string) (string, bool) {
+	if slf.expiryCheck <= 0 {
+		return "", false
+	}
+	slf.trackedLock.Lock()
+	defer slf.trackedLock.Unlock()
+	username, exist := slf.trackedSessions[sessionId]
+	delete(slf.trackedSessions, sessionId)
+	return username, exist
+}
+
+// 会话已不存在时触发过期事件
+func (slf *auth) sessionExpired(sessionId string) {
+	if username, exist := slf.untrackSession(sessionId); exist {
+		slf.notify(context.Background(), Event{Type: EventSessionExpired, Username: username, SessionID: sessionId})
+	}
+}
+
+// 定期检查所有记录的会话是否过期
+func (slf *auth) watchSessionExpiry() {
+	ticker := time.NewTicker(slf.expiryCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-slf.closed:
+			return
+		case <-ticker.C:
+		}
+		slf.trackedLock.Lock()
+		sessionIds := make([]string, 0, len(slf.trackedSessions))
+		for sessionId := range slf.trackedSessions {
+			sessionIds = append(sessionIds, sessionId)
+		}
+		slf.trackedLock.Unlock()
+		for _, sessionId := range sessionIds {
+			if _, err := slf.sm.GetSession(sessionId); err != nil && errors.Is(sessionError(err), ErrNotLoggedIn) {
+				slf.sessionExpired(sessionId)
+			}
+		}
+	}
+}
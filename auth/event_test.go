@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth_Events(t *testing.T) {
+	manager := session.NewManagerMemory()
+	auth, err := New(manager, WithRefreshToken(RefreshOptions{}), WithSessionExpiryCheck(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetRoleCheck(func(username string, roleHelper *RoleHelper) ([]Role, error) {
+		return []Role{roleHelper.NewRole("user")}, nil
+	})
+	auth.AddTempAccount("admin", "12345")
+	auth.AddTempAccount("guest", "12345")
+
+	events := make(chan Event, 32)
+	unsubscribe := auth.Subscribe(func(event Event) {
+		events <- event
+	})
+	defer unsubscribe()
+	expect := func(eventType EventType, username string) Event {
+		select {
+		case event := <-events:
+			if event.Type != eventType || event.Username != username {
+				t.Fatalf("expect %s of %s, got %s of %s", eventType, username, event.Type, event.Username)
+			}
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expect %s, got nothing", eventType)
+		}
+		return Event{}
+	}
+
+	// 钩子拒绝登录
+	removeHook := auth.Hook(func(ctx context.Context, event Event) error {
+		if event.Username == "guest" {
+			return errors.New("guest is disabled")
+		}
+		return nil
+	}, EventLoginSucceeded)
+	if _, err = auth.Login().Password("guest", "12345"); !errors.Is(err, ErrVetoed) || errors.Unwrap(err).Error() != "guest is disabled" {
+		t.Fatal("expect vetoed, got", err)
+	}
+	if event := expect(EventLoginFailed, "guest"); !errors.Is(event.Err, ErrVetoed) {
+		t.Fatal("unexpected login failed event", event)
+	}
+	removeHook()
+
+	if _, err = auth.Login().UseSourceIP("10.0.0.1").Password("admin", "54321"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal(err)
+	}
+	if event := expect(EventLoginFailed, "admin"); event.Device.IP != "10.0.0.1" || !errors.Is(event.Err, ErrInvalidCredentials) {
+		t.Fatal("unexpected login failed event", event)
+	}
+
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := expect(EventLoginSucceeded, "admin"); event.SessionID != consumer.GetTag() {
+		t.Fatal("unexpected session id", event.SessionID)
+	}
+	if err = auth.RefreshRole(consumer); err != nil {
+		t.Fatal(err)
+	}
+	if event := expect(EventRolesRefreshed, "admin"); len(event.Roles) != 1 {
+		t.Fatal("unexpected roles", event.Roles)
+	}
+	refreshToken, _ := consumer.GetRefreshToken()
+	if consumer, err = auth.Refresh(refreshToken); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventRolesRefreshed, "admin")
+	expect(EventTokenRefreshed, "admin")
+
+	// 钩子拒绝退出登录
+	removeHook = auth.Hook(func(ctx context.Context, event Event) error {
+		return errors.New("logout is disabled")
+	}, EventLoggedOut)
+	if err = consumer.OutLogin(); !errors.Is(err, ErrVetoed) || !auth.IsLogin(consumer) {
+		t.Fatal("expect vetoed, got", err)
+	}
+	removeHook()
+	if err = consumer.OutLogin(); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventLoggedOut, "admin")
+
+	if consumer, err = auth.Login().Password("admin", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventLoginSucceeded, "admin")
+	if err = auth.Ban(consumer); err != nil {
+		t.Fatal(err)
+	}
+	if event := expect(EventBanned, "admin"); event.Actor != ActorSystem {
+		t.Fatal("unexpected actor", event.Actor)
+	}
+
+	// 会话过期
+	if err = auth.SetExpired(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if consumer, err = auth.Login().Password("admin", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventLoginSucceeded, "admin")
+	if event := expect(EventSessionExpired, "admin"); event.SessionID != consumer.GetTag() {
+		t.Fatal("unexpected session id", event.SessionID)
+	}
+	if err = auth.SetExpired(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var next int
+	auth.SetAllowManyClient(func() string {
+		next++
+		return string(rune('a' + next))
+	})
+	auth.SetMaxClients(1, EvictOldest)
+	for i := 0; i < 2; i++ {
+		if _, err = auth.Login().Password("admin", "12345"); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			// 踢出发生在新的登录生效前
+			expect(EventEvicted, "admin")
+		}
+		expect(EventLoginSucceeded, "admin")
+	}
+}
+
+func TestAuth_SubscriberOverflow(t *testing.T) {
+	logger := new(testLogger)
+	a, err := New(session.NewManagerMemory(), WithLogger(logger), WithSessionExpiryCheck(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := make(chan struct{})
+	received := make(chan struct{}, 1)
+	a.Subscribe(func(event Event) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-block
+	})
+
+	// 订阅者缓冲区已满时丢弃事件，不阻塞发布者
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize+2; i++ {
+			a.(*auth).publish(newEvent(Event{Type: EventLoginFailed, Username: "admin"}))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publish should not block on a full subscriber")
+	}
+	if !strings.Contains(logger.String(), "WARN drop event, subscriber buffer is full type=login_failed username=admin") {
+		t.Fatal("expect dropped event to be logged, got:\n", logger.String())
+	}
+
+	<-received
+
+	// 关闭后取消所有订阅者
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	if len(a.(*auth).events.subscribers) != 0 {
+		t.Fatal("subscribers should be removed after close")
+	}
+
+	// 关闭后的订阅不会被注册
+	unsubscribe := a.Subscribe(func(event Event) {})
+	if len(a.(*auth).events.subscribers) != 0 {
+		t.Fatal("subscribe after close should be ignored")
+	}
+	unsubscribe()
+}
+
+func TestAuth_BanAllFailure(t *testing.T) {
+	logger := new(testLogger)
+	a, err := New(session.NewManagerMemory(), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AddTempAccount("admin", "12345")
+	consumer, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Hook(func(ctx context.Context, event Event) error {
+		return errors.New("keep sessions")
+	}, EventBanned)
+
+	// 系统踢出消费者失败时记录日志
+	a.SetUnAllowManyClient()
+	if !a.IsLogin(consumer) {
+		t.Fatal("vetoed consumer should be kept")
+	}
+	if !strings.Contains(logger.String(), "WARN ban consumer failed") {
+		t.Fatal("expect ban failure to be logged, got:\n", logger.String())
+	}
+}
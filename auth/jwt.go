@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	jwtAlgHS256 = "HS256"
+	jwtAlgRS256 = "RS256"
+
+	defaultJWTExpire = 24 * time.Hour
+)
+
+// JWTOptions JWT令牌模式配置
+type JWTOptions struct {
+	Issuer string        // 签发者（iss），不为空时将在解析时进行校验
+	Expire time.Duration // 令牌有效期（exp），默认24小时
+	Secret []byte        // HS256 签名密钥，为空时采用认证器密钥环中的当前密钥签名，不可与 WithKeyProvider 同时使用
+}
+
+// 令牌头
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+func newJWTTokenizer(options JWTOptions, ring *keyRing) *jwtTokenizer {
+	if options.Expire <= 0 {
+		options.Expire = defaultJWTExpire
+	}
+	return &jwtTokenizer{
+		options:  options,
+		ring:     ring,
+		verifier: newJWTVerifier(ring.lookup, options.Issuer),
+	}
+}
+
+// 签发JWT格式令牌，可在不访问会话管理器的情况下完成校验
+type jwtTokenizer struct {
+	options  JWTOptions
+	ring     *keyRing
+	verifier *JWTVerifier
+}
+
+func (slf *jwtTokenizer) issue(consumer Consumer) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := &Claims{
+		Issuer:    slf.options.Issuer,
+		Subject:   consumer.GetUsername(),
+		SessionID: consumer.GetTag(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(slf.options.Expire).Unix(),
+		ID:        jti,
+	}
+	for _, r := range consumer.GetAllRole() {
+		claims.Roles = append(claims.Roles, r.GetName())
+	}
+	return signJWT(slf.ring.current(), claims)
+}
+
+func (slf *jwtTokenizer) parse(token string) (*Claims, error) {
+	return slf.verifier.Verify(token)
+}
+
+// 使用密钥对声明进行签名，对称密钥采用 HS256，RSA私钥采用 RS256
+func signJWT(key *Key, claims interface{}) (string, error) {
+	header := jwtHeader{Typ: "JWT", Kid: key.ID}
+	switch {
+	case len(key.Secret) > 0:
+		header.Alg = jwtAlgHS256
+	case key.PrivateKey != nil:
+		header.Alg = jwtAlgRS256
+	default:
+		return "", errors.New("jwt signing requires a secret or rsa private key")
+	}
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJson, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(claimsJson)
+
+	var signature []byte
+	if header.Alg == jwtAlgHS256 {
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// NewJWTVerifier 创建一个JWT令牌校验器
+//
+// key 支持 []byte（HS256）、*rsa.PublicKey（RS256）、*Key 及 []*Key（按令牌头中的 kid 选择密钥）；
+// issuer 不为空时将要求令牌签发者一致。校验过程完全离线，适用于网关等无法访问会话管理器的场景
+func NewJWTVerifier(key interface{}, issuer string) *JWTVerifier {
+	var keys []*Key
+	switch k := key.(type) {
+	case []byte:
+		keys = []*Key{{Secret: k}}
+	case *rsa.PublicKey:
+		keys = []*Key{{PublicKey: k}}
+	case *Key:
+		keys = []*Key{k}
+	case []*Key:
+		keys = k
+	}
+	return newJWTVerifier(func(kid string) (*Key, error) {
+		if len(keys) == 1 && (kid == "" || keys[0].ID == "" || keys[0].ID == kid) {
+			return keys[0], nil
+		}
+		for _, k := range keys {
+			if k.ID == kid {
+				return k, nil
+			}
+		}
+		return nil, errors.New("no jwt verify key found with key id: " + kid)
+	}, issuer)
+}
+
+func newJWTVerifier(keyFunc func(kid string) (*Key, error), issuer string) *JWTVerifier {
+	return &JWTVerifier{
+		keyFunc: keyFunc,
+		issuer:  issuer,
+	}
+}
+
+// JWTVerifier JWT令牌离线校验器
+type JWTVerifier struct {
+	keyFunc func(kid string) (*Key, error) // 根据密钥id获取校验密钥
+	issuer  string                         // 期望的签发者
+}
+
+// Verify 校验令牌签名及有效期，并返回令牌声明
+func (slf *JWTVerifier) Verify(token string) (*Claims, error) {
+	var claims = new(Claims)
+	if err := slf.verify(token, claims); err != nil {
+		return nil, wrapError(ErrInvalidToken, err)
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	if slf.issuer != "" && claims.Issuer != slf.issuer {
+		return nil, newError(ErrInvalidToken, "unexpected jwt issuer: "+claims.Issuer)
+	}
+	if claims.SessionID == "" {
+		return nil, newError(ErrInvalidToken, "jwt token does not contain consumer tag")
+	}
+	return claims, nil
+}
+
+// 校验令牌签名，并将声明解析至 claims
+func (slf *JWTVerifier) verify(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed jwt token")
+	}
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(headerJson, &header); err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	key, err := slf.keyFunc(header.Kid)
+	if err != nil {
+		return err
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	switch header.Alg {
+	case jwtAlgHS256:
+		if len(key.Secret) == 0 {
+			return errors.New("unexpected jwt signing algorithm: " + header.Alg)
+		}
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid jwt signature")
+		}
+	case jwtAlgRS256:
+		if key.PublicKey == nil {
+			return errors.New("unexpected jwt signing algorithm: " + header.Alg)
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err = rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid jwt signature")
+		}
+	default:
+		return errors.New("unsupported jwt signing algorithm: " + header.Alg)
+	}
+
+	claimsJson, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(claimsJson, claims)
+}
+
+// 生成令牌唯一标识
+func newJTI() (string, error) {
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
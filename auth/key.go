@@ -0,0 +1,404 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeyBits        = 2048
+	defaultKeyGracePeriod = 24 * time.Hour
+)
+
+// Key 令牌签名及加密密钥
+type Key struct {
+	ID         string          // 密钥id（kid），为空时将使用 RFC 7638 指纹
+	PrivateKey *rsa.PrivateKey // RSA私钥，用于加密令牌的解密及 RS256 签名
+	PublicKey  *rsa.PublicKey  // RSA公钥，用于加密令牌的加密及 RS256 校验
+	Secret     []byte          // 对称密钥，仅可用于 HS256 签名及校验
+}
+
+// KeyProvider 密钥提供者
+type KeyProvider interface {
+	// Load 加载用于签发令牌的当前密钥，认证器创建及轮换密钥时将被调用
+	Load() (*Key, error)
+}
+
+// KeyProviderFunc 函数形式的密钥提供者
+type KeyProviderFunc func() (*Key, error)
+
+// Load 加载密钥
+func (slf KeyProviderFunc) Load() (*Key, error) {
+	return slf()
+}
+
+// NewGeneratedKeyProvider 每次加载时生成一个新的RSA密钥，bits 小于等于 0 时采用 2048 位
+//
+// 生成的密钥不会持久化，多副本部署时应使用 NewPEMFileKeyProvider 或 NewJWKFileKeyProvider
+func NewGeneratedKeyProvider(bits int) KeyProvider {
+	if bits <= 0 {
+		bits = defaultKeyBits
+	}
+	return KeyProviderFunc(func() (*Key, error) {
+		privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(&Key{PrivateKey: privateKey})
+	})
+}
+
+// NewStaticKeyProvider 始终提供同一个密钥，每次加载时返回其副本，key 不会被修改
+func NewStaticKeyProvider(key *Key) KeyProvider {
+	return KeyProviderFunc(func() (*Key, error) {
+		return newKey(key)
+	})
+}
+
+// NewPEMKeyProvider 从PEM编码的数据中加载密钥
+func NewPEMKeyProvider(data []byte) KeyProvider {
+	return KeyProviderFunc(func() (*Key, error) {
+		return ParsePEMKey(data)
+	})
+}
+
+// NewPEMFileKeyProvider 从PEM文件中加载密钥，每次加载都将重新读取文件，可在替换文件后调用 Auth.RotateKeys 完成轮换
+func NewPEMFileKeyProvider(path string) KeyProvider {
+	return KeyProviderFunc(func() (*Key, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePEMKey(data)
+	})
+}
+
+// NewJWKKeyProvider 从JWK数据中加载密钥
+func NewJWKKeyProvider(data []byte) KeyProvider {
+	return KeyProviderFunc(func() (*Key, error) {
+		return ParseJWK(data)
+	})
+}
+
+// NewJWKFileKeyProvider 从JWK文件中加载密钥，每次加载都将重新读取文件，可在替换文件后调用 Auth.RotateKeys 完成轮换
+func NewJWKFileKeyProvider(path string) KeyProvider {
+	return KeyProviderFunc(func() (*Key, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJWK(data)
+	})
+}
+
+// ParsePEMKey 解析PEM编码的RSA私钥（PKCS#1、PKCS#8）或公钥（PKIX、PKCS#1）
+func ParsePEMKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	var key = new(Key)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("unsupported private key type, only rsa is supported")
+		}
+		key.PrivateKey = rsaKey
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("unsupported public key type, only rsa is supported")
+		}
+		key.PublicKey = rsaKey
+	case "RSA PUBLIC KEY":
+		publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = publicKey
+	default:
+		return nil, errors.New("unsupported pem block type: " + block.Type)
+	}
+	return newKey(key)
+}
+
+// 单个JWK
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// ParseJWK 解析单个JWK，支持 RSA 及 oct 类型
+func ParseJWK(data []byte) (*Key, error) {
+	var j jwk
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return j.toKey()
+}
+
+// ParseJWKSet 解析JWK集合（{"keys": [...]}），支持 RSA 及 oct 类型，不支持的密钥类型将被忽略
+//
+// 用于校验第三方签发的令牌时，应仅信任其中的RSA公钥，公开发布的对称密钥不可用于校验签名
+func ParseJWKSet(data []byte) ([]*Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	for _, j := range set.Keys {
+		if j.Kty != "RSA" && j.Kty != "oct" {
+			continue
+		}
+		key, err := j.toKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (slf *jwk) toKey() (*Key, error) {
+	var key = &Key{ID: slf.Kid}
+	switch slf.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(slf.K)
+		if err != nil {
+			return nil, err
+		}
+		key.Secret = secret
+	case "RSA":
+		n, err := decodeJWKInt(slf.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(slf.E)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if slf.D == "" {
+			key.PublicKey = publicKey
+			break
+		}
+		d, err := decodeJWKInt(slf.D)
+		if err != nil {
+			return nil, err
+		}
+		p, err := decodeJWKInt(slf.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeJWKInt(slf.Q)
+		if err != nil {
+			return nil, err
+		}
+		privateKey := &rsa.PrivateKey{PublicKey: *publicKey, D: d, Primes: []*big.Int{p, q}}
+		if err = privateKey.Validate(); err != nil {
+			return nil, err
+		}
+		privateKey.Precompute()
+		key.PrivateKey = privateKey
+	default:
+		return nil, errors.New("unsupported jwk key type: " + slf.Kty)
+	}
+	return newKey(key)
+}
+
+// 解码JWK中的大整数
+func decodeJWKInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, errors.New("missing jwk parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// 复制密钥并补全公钥及密钥id，不会修改传入的密钥
+func newKey(key *Key) (*Key, error) {
+	if key == nil {
+		return nil, errors.New("key is nil")
+	}
+	copied := *key
+	key = &copied
+	if key.PrivateKey != nil && key.PublicKey == nil {
+		key.PublicKey = &key.PrivateKey.PublicKey
+	}
+	if key.PublicKey == nil && len(key.Secret) == 0 {
+		return nil, errors.New("key does not contain any key material")
+	}
+	if key.ID == "" {
+		key.ID = keyThumbprint(key)
+	}
+	return key, nil
+}
+
+// 计算 RFC 7638 密钥指纹
+func keyThumbprint(key *Key) string {
+	var members string
+	if key.PublicKey != nil {
+		e := big.NewInt(int64(key.PublicKey.E)).Bytes()
+		members = `{"e":"` + base64.RawURLEncoding.EncodeToString(e) +
+			`","kty":"RSA","n":"` + base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()) + `"}`
+	} else {
+		members = `{"k":"` + base64.RawURLEncoding.EncodeToString(key.Secret) + `","kty":"oct"}`
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// 已退役的密钥
+type retiredKey struct {
+	key   *Key
+	until time.Time // 该时间之前仍可用于校验
+}
+
+func newKeyRing(provider KeyProvider, grace time.Duration, check func(key *Key) error) (*keyRing, error) {
+	ring := &keyRing{
+		provider: provider,
+		grace:    grace,
+		check:    check,
+	}
+	active, err := ring.load()
+	if err != nil {
+		return nil, err
+	}
+	ring.active = active
+	return ring, nil
+}
+
+// 校验密钥可用于 RSA 令牌模式，加密令牌的解密需要RSA私钥
+func checkRsaTokenKey(key *Key) error {
+	if key.PrivateKey == nil {
+		return errors.New("rsa token requires an rsa private key")
+	}
+	return nil
+}
+
+// 校验密钥可用于 JWT 令牌模式，签名需要对称密钥或RSA私钥
+func checkJWTTokenKey(key *Key) error {
+	if len(key.Secret) == 0 && key.PrivateKey == nil {
+		return errors.New("jwt token requires a secret or rsa private key")
+	}
+	return nil
+}
+
+// 密钥环，持有当前签发密钥及处于宽限期内的退役密钥
+type keyRing struct {
+	sync.RWMutex
+	provider KeyProvider          // 密钥提供者
+	grace    time.Duration        // 退役密钥宽限期
+	active   *Key                 // 当前签发密钥
+	retired  []retiredKey         // 退役密钥
+	check    func(key *Key) error // 校验密钥是否可用于当前令牌模式
+}
+
+// 从密钥提供者加载密钥并校验其是否可用于当前令牌模式
+func (slf *keyRing) load() (*Key, error) {
+	key, err := slf.provider.Load()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.New("key provider returned a nil key")
+	}
+	if slf.check != nil {
+		if err = slf.check(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// 获取当前签发密钥
+func (slf *keyRing) current() *Key {
+	slf.RLock()
+	defer slf.RUnlock()
+	return slf.active
+}
+
+// 根据密钥id查找可用于校验的密钥
+func (slf *keyRing) lookup(kid string) (*Key, error) {
+	for _, key := range slf.verifyKeys() {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, errors.New("unknown or retired key id: " + kid)
+}
+
+// 获取所有可用于校验的密钥，当前签发密钥排在首位
+func (slf *keyRing) verifyKeys() []*Key {
+	slf.RLock()
+	defer slf.RUnlock()
+	var now = time.Now()
+	var keys = []*Key{slf.active}
+	for _, r := range slf.retired {
+		if now.Before(r.until) {
+			keys = append(keys, r.key)
+		}
+	}
+	return keys
+}
+
+// 轮换密钥，原签发密钥将在宽限期后失效，新密钥不可用于当前令牌模式时保留原签发密钥
+func (slf *keyRing) rotate() error {
+	key, err := slf.load()
+	if err != nil {
+		return err
+	}
+	slf.Lock()
+	defer slf.Unlock()
+	if key.ID == slf.active.ID {
+		return errors.New("key provider returned the active key, nothing to rotate")
+	}
+	var now = time.Now()
+	var retired = []retiredKey{{key: slf.active, until: now.Add(slf.grace)}}
+	for _, r := range slf.retired {
+		if now.Before(r.until) && r.key.ID != key.ID {
+			retired = append(retired, r)
+		}
+	}
+	slf.active = key
+	slf.retired = retired
+	return nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import "sync"
+
+// 按键加锁的互斥锁，不同键之间互不阻塞，零值可用
+type keyedMutex struct {
+	lock  sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int // 持有及等待该锁的数量，为 0 时释放
+}
+
+// Lock 锁定特定键，返回解锁函数
+func (slf *keyedMutex) Lock(key string) func() {
+	slf.lock.Lock()
+	if slf.locks == nil {
+		slf.locks = map[string]*keyedLock{}
+	}
+	l, exist := slf.locks[key]
+	if !exist {
+		l = new(keyedLock)
+		slf.locks[key] = l
+	}
+	l.refs++
+	slf.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		slf.lock.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(slf.locks, key)
+		}
+		slf.lock.Unlock()
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"time"
+)
+
+// LDAPOptions LDAP验证配置
+type LDAPOptions struct {
+	URL            string        // 服务地址，如 ldap://127.0.0.1:389 或 ldaps://127.0.0.1:636
+	BindDN         string        // 服务账号DN，用于搜索用户
+	BindPassword   string        // 服务账号密码
+	BaseDN         string        // 搜索用户的基准DN
+	UserFilter     string        // 搜索用户的过滤器，%s 将被替换为转义后的用户名，默认 (uid=%s)
+	GroupAttribute string        // 用户所属组的属性，默认 memberOf
+	StartTLS       bool          // 是否在 ldap:// 连接上启用 StartTLS
+	TLSConfig      *tls.Config   // TLS配置，用于 ldaps:// 及 StartTLS
+	Timeout        time.Duration // 连接及请求超时时间，默认10秒，通过 CheckContext 验证时不超过 ctx 的剩余时间
+}
+
+// NewLDAPChecker 创建一个LDAP密码验证器
+//
+// 验证时将使用服务账号绑定并根据 UserFilter 搜索用户DN，随后以用户DN及密码重新绑定
+func NewLDAPChecker(options LDAPOptions) *LDAPChecker {
+	if options.UserFilter == "" {
+		options.UserFilter = "(uid=%s)"
+	}
+	if options.GroupAttribute == "" {
+		options.GroupAttribute = "memberOf"
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	return &LDAPChecker{options: options}
+}
+
+// LDAPChecker LDAP密码验证器
+type LDAPChecker struct {
+	options LDAPOptions
+}
+
+// Check 验证用户名及密码，可直接作为 UsePasswordChecker 的验证器使用，不受请求取消的影响，建议使用 CheckContext
+func (slf *LDAPChecker) Check(username string, password string) error {
+	return slf.CheckContext(context.Background(), username, password)
+}
+
+// CheckContext 验证用户名及密码，可直接作为 UsePasswordCheckerContext 的验证器使用
+//
+// 连接及请求的超时时间不超过 ctx 的剩余时间，ctx 被取消时将中断与LDAP服务的连接并返回 ctx 的错误
+func (slf *LDAPChecker) CheckContext(ctx context.Context, username string, password string) error {
+	// 空密码在LDAP中会被视为匿名绑定而成功，必须提前拒绝
+	if username == "" || password == "" {
+		return ErrInvalidCredentials
+	}
+	conn, timeout, release, err := slf.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	entry, err := slf.search(conn, username, timeout)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ErrInvalidCredentials
+		}
+		return contextError(ctx, wrapError(ErrStore, err))
+	}
+	return nil
+}
+
+// Groups 获取用户在LDAP中所属的组
+func (slf *LDAPChecker) Groups(username string) ([]string, error) {
+	conn, timeout, release, err := slf.dial(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	entry, err := slf.search(conn, username, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return entry.GetAttributeValues(slf.options.GroupAttribute), nil
+}
+
+// RoleSetter 生成可用于 SetRoleCheck 的角色设置函数，mapper 负责将用户所属的LDAP组映射为角色
+func (slf *LDAPChecker) RoleSetter(mapper func(groups []string, roleHelper *RoleHelper) ([]Role, error)) func(username string, roleHelper *RoleHelper) ([]Role, error) {
+	return func(username string, roleHelper *RoleHelper) ([]Role, error) {
+		groups, err := slf.Groups(username)
+		if err != nil {
+			return nil, err
+		}
+		return mapper(groups, roleHelper)
+	}
+}
+
+// 连接LDAP服务并以服务账号绑定，返回本次连接的超时时间及释放连接的函数
+//
+// 超时时间取 Timeout 与 ctx 剩余时间的较小值，ctx 被取消时连接将被关闭以中断进行中的请求
+func (slf *LDAPChecker) dial(ctx context.Context) (*ldap.Conn, time.Duration, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, nil, err
+	}
+	timeout := slf.options.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remain := time.Until(deadline); remain < timeout {
+			timeout = remain
+		}
+	}
+	conn, err := ldap.DialURL(slf.options.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(slf.options.TLSConfig),
+	)
+	if err != nil {
+		return nil, 0, nil, contextError(ctx, wrapError(ErrStore, err))
+	}
+	conn.SetTimeout(timeout)
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	release := func() {
+		stop()
+		_ = conn.Close()
+	}
+	if slf.options.StartTLS {
+		if err = conn.StartTLS(slf.options.TLSConfig); err != nil {
+			release()
+			return nil, 0, nil, contextError(ctx, wrapError(ErrStore, err))
+		}
+	}
+	if slf.options.BindDN != "" {
+		err = conn.Bind(slf.options.BindDN, slf.options.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		release()
+		return nil, 0, nil, contextError(ctx, wrapError(ErrStore, err))
+	}
+	return conn, timeout, release, nil
+}
+
+// ctx 已结束时以 ctx 的错误代替因连接被中断或超时产生的错误
+//
+// 连接的超时时间与 ctx 的截止时间相同，连接超时时 ctx 可能尚未标记为结束，因此同时比较截止时间
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// 搜索用户条目，仅当唯一匹配时返回
+func (slf *LDAPChecker) search(conn *ldap.Conn, username string, timeout time.Duration) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		slf.options.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(timeout/time.Second), false,
+		fmt.Sprintf(slf.options.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", slf.options.GroupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, wrapError(ErrStore, err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/kercylan98/go-session/session"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 进程内的模拟LDAP服务，仅支持简单绑定及搜索
+type fakeLDAPServer struct {
+	net.Listener
+	entries map[string]*fakeLDAPEntry // dn -> 条目
+}
+
+type fakeLDAPEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+func newFakeLDAPServer(t *testing.T, entries map[string]*fakeLDAPEntry) *fakeLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeLDAPServer{Listener: listener, entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (slf *fakeLDAPServer) URL() string {
+	return "ldap://" + slf.Addr().String()
+}
+
+func (slf *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageId := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case 0: // BindRequest
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			var code int64 = 49
+			if entry, exist := slf.entries[dn]; (dn == "" && password == "") || (exist && password != "" && entry.password == password) {
+				code = 0
+			}
+			_, _ = conn.Write(fakeLDAPResult(messageId, 1, code).Bytes())
+		case 2: // UnbindRequest
+			return
+		case 3: // SearchRequest
+			baseDN := strings.ToLower(op.Children[0].Value.(string))
+			for dn, entry := range slf.entries {
+				if !strings.HasSuffix(strings.ToLower(dn), baseDN) || !entry.match(op.Children[6]) {
+					continue
+				}
+				response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "Search Result Entry")
+				response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+				attributes := ber.NewSequence("Attributes")
+				for name, values := range entry.attributes {
+					attribute := ber.NewSequence("Attribute")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+					for _, value := range values {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+					}
+					attribute.AppendChild(set)
+					attributes.AppendChild(attribute)
+				}
+				response.AppendChild(attributes)
+				_, _ = conn.Write(fakeLDAPMessage(messageId, response).Bytes())
+			}
+			_, _ = conn.Write(fakeLDAPResult(messageId, 5, 0).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+// 判断条目是否匹配过滤器，仅支持 and、or、not、等值及存在性过滤
+func (slf *fakeLDAPEntry) match(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0:
+		for _, child := range filter.Children {
+			if !slf.match(child) {
+				return false
+			}
+		}
+		return true
+	case 1:
+		for _, child := range filter.Children {
+			if slf.match(child) {
+				return true
+			}
+		}
+		return false
+	case 2:
+		return !slf.match(filter.Children[0])
+	case 3:
+		for _, value := range slf.values(filter.Children[0].Value.(string)) {
+			if strings.EqualFold(value, filter.Children[1].Value.(string)) {
+				return true
+			}
+		}
+		return false
+	case 7:
+		return len(slf.values(filter.Data.String())) > 0
+	}
+	return false
+}
+
+func (slf *fakeLDAPEntry) values(attribute string) []string {
+	for name, values := range slf.attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+func fakeLDAPMessage(messageId int64, op *ber.Packet) *ber.Packet {
+	packet := ber.NewSequence("LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func fakeLDAPResult(messageId int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return fakeLDAPMessage(messageId, op)
+}
+
+func TestLDAPChecker(t *testing.T) {
+	server := newFakeLDAPServer(t, map[string]*fakeLDAPEntry{
+		"cn=service,dc=example,dc=com": {password: "service-secret"},
+		"uid=alice,ou=people,dc=example,dc=com": {password: "alice-secret", attributes: map[string][]string{
+			"uid":      {"alice"},
+			"memberOf": {"cn=admins,ou=groups,dc=example,dc=com"},
+		}},
+		"uid=bob,ou=people,dc=example,dc=com": {password: "bob-secret", attributes: map[string][]string{
+			"uid": {"bob"},
+		}},
+	})
+	defer server.Close()
+
+	checker := NewLDAPChecker(LDAPOptions{
+		URL:          server.URL(),
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+	})
+	for _, c := range []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"alice", "alice-secret", true},
+		{"alice", "wrong", false},
+		{"alice", "", false},
+		{"nobody", "alice-secret", false},
+		{"*", "alice-secret", false},
+	} {
+		if err := checker.Check(c.username, c.password); (err == nil) != c.ok {
+			t.Fatalf("check %s/%s: expect ok=%v, got %v", c.username, c.password, c.ok, err)
+		}
+	}
+
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetRoleCheck(checker.RoleSetter(func(groups []string, roleHelper *RoleHelper) ([]Role, error) {
+		var roles []Role
+		for _, group := range groups {
+			if group == "cn=admins,ou=groups,dc=example,dc=com" {
+				roles = append(roles, roleHelper.NewRole("admin").
+					AddResourceGroup(roleHelper.NewResourceGroup("admin").
+						Add(roleHelper.NewResource("admin", "/admin"))))
+			}
+		}
+		return roles, nil
+	}))
+
+	alice, err := auth.Login().UsePasswordChecker(checker.Check).Password("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.ResourceExist("/admin") {
+		t.Fatal("alice should be mapped to admin role")
+	}
+	bob, err := auth.Login().UsePasswordCheckerContext(checker.CheckContext).Password("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.ResourceExist("/admin") {
+		t.Fatal("bob should not have admin role")
+	}
+}
+
+func TestLDAPChecker_Context(t *testing.T) {
+	// 接受连接但从不响应的服务
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	checker := NewLDAPChecker(LDAPOptions{
+		URL:          "ldap://" + listener.Addr().String(),
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		Timeout:      time.Minute,
+	})
+
+	// 超时时间不超过 ctx 的剩余时间
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = checker.CheckContext(ctx, "alice", "alice-secret"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expect deadline exceeded, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatal("check should stop at the ctx deadline, took", elapsed)
+	}
+
+	// ctx 被取消时中断请求
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err = checker.CheckContext(ctx, "alice", "alice-secret"); !errors.Is(err, context.Canceled) {
+		t.Fatal("expect canceled, got", err)
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"github.com/kercylan98/go-session/session"
+	"strconv"
+	"time"
+)
+
+const (
+	loginFailurePrefix = "__x_x__login_failure:" // 登录失败计数会话id前缀
+	loginFailureUser   = "user:"                 // 用户名计数
+	loginFailureIP     = "ip:"                   // 来源IP计数
+
+	failureKeyCount       = "count"        // 连续失败次数
+	failureKeyLockedUntil = "locked_until" // 锁定截止时间
+	failureKeyLastFailure = "last_failure" // 最后一次失败时间
+)
+
+// LockoutOptions 密码登录防暴力破解配置
+type LockoutOptions struct {
+	FreeAttempts    int           // 不受限制的连续失败次数，默认3次
+	MaxAttempts     int           // 连续失败达到该次数后锁定 LockoutDuration，默认10次
+	BaseDelay       time.Duration // 超出 FreeAttempts 后首次失败需等待的时间，此后每次失败翻倍，默认1秒
+	LockoutDuration time.Duration // 锁定时间，同时也是等待时间的上限，默认15分钟
+	ResetAfter      time.Duration // 距最后一次失败超过该时间后失败次数清零，默认1小时
+	SourceIPFactor  int           // 来源IP的失败次数阈值为用户名阈值的倍数，默认10倍
+}
+
+// WithLockout 启用密码登录防暴力破解，失败次数分别按用户名及来源IP（通过 LoginModeSelector.UseSourceIP 设置）计数并存储于会话管理器中
+//
+// 超出 FreeAttempts 后每次失败的等待时间指数增长，达到 MaxAttempts 后锁定，等待及锁定期间的登录将直接返回 *AccountLockedError
+func WithLockout(options LockoutOptions) Option {
+	return func(auth *auth) error {
+		if options.FreeAttempts <= 0 {
+			options.FreeAttempts = 3
+		}
+		if options.MaxAttempts <= options.FreeAttempts {
+			options.MaxAttempts = options.FreeAttempts + 7
+		}
+		if options.BaseDelay <= 0 {
+			options.BaseDelay = time.Second
+		}
+		if options.LockoutDuration <= 0 {
+			options.LockoutDuration = 15 * time.Minute
+		}
+		if options.ResetAfter <= 0 {
+			options.ResetAfter = time.Hour
+		}
+		if options.SourceIPFactor <= 0 {
+			options.SourceIPFactor = 10
+		}
+		auth.lockoutOptions = &options
+		return nil
+	}
+}
+
+func (slf *auth) UnlockAccount(username string) error {
+	return slf.resetLoginFailure(loginFailureUser + username)
+}
+
+func (slf *auth) UnlockSourceIP(ip string) error {
+	return slf.resetLoginFailure(loginFailureIP + ip)
+}
+
+// 锁定用户的密码校验，未启用防暴力破解时不加锁
+func (slf *auth) lockLogin(username string) func() {
+	if slf.lockoutOptions == nil {
+		return func() {}
+	}
+	return slf.loginLocks.Lock(username)
+}
+
+// 检查用户名及来源IP是否被锁定
+func (slf *auth) checkLockout(username string, ip string) error {
+	if slf.lockoutOptions == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, id := range slf.loginFailureIds(username, ip) {
+		if _, _, lockedUntil := slf.loadLoginFailure(id, now); now.Before(lockedUntil) {
+			return &AccountLockedError{Until: lockedUntil}
+		}
+	}
+	return nil
+}
+
+// 记录一次登录失败
+func (slf *auth) loginFailed(username string, ip string) {
+	if slf.lockoutOptions == nil {
+		return
+	}
+	slf.lockoutLock.Lock()
+	defer slf.lockoutLock.Unlock()
+	now := time.Now()
+	for _, id := range slf.loginFailureIds(username, ip) {
+		ses, count, _ := slf.loadLoginFailure(id, now)
+		if ses == nil {
+			var err error
+			if ses, err = slf.sm.RegisterSession(loginFailurePrefix + id); err != nil {
+				continue
+			}
+		}
+		count++
+		factor := 1
+		if id != loginFailureUser+username {
+			factor = slf.lockoutOptions.SourceIPFactor
+		}
+		lockedUntil := now.Add(slf.lockoutDelay(count, factor))
+		for key, value := range map[string]string{
+			failureKeyCount:       strconv.Itoa(count),
+			failureKeyLockedUntil: strconv.FormatInt(lockedUntil.UnixNano(), 10),
+			failureKeyLastFailure: strconv.FormatInt(now.UnixNano(), 10),
+		} {
+			_ = ses.Store(key, value)
+		}
+	}
+}
+
+// 登录成功后清零用户名的失败次数，来源IP的失败次数不会因单个账号登录成功而清零
+func (slf *auth) loginSucceeded(username string) {
+	if slf.lockoutOptions == nil {
+		return
+	}
+	_ = slf.resetLoginFailure(loginFailureUser + username)
+}
+
+// 第 count 次连续失败后需等待的时间
+func (slf *auth) lockoutDelay(count int, factor int) time.Duration {
+	options := slf.lockoutOptions
+	free, max := options.FreeAttempts*factor, options.MaxAttempts*factor
+	switch {
+	case count <= free:
+		return 0
+	case count >= max:
+		return options.LockoutDuration
+	}
+	delay := options.BaseDelay
+	for i := free + 1; i < count && delay < options.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > options.LockoutDuration {
+		delay = options.LockoutDuration
+	}
+	return delay
+}
+
+// 获取需要计数的id
+func (slf *auth) loginFailureIds(username string, ip string) []string {
+	ids := []string{loginFailureUser + username}
+	if ip != "" {
+		ids = append(ids, loginFailureIP+ip)
+	}
+	return ids
+}
+
+// 载入失败计数，不存在时返回空会话，距最后一次失败超过 ResetAfter 且未锁定时失败次数视为0
+func (slf *auth) loadLoginFailure(id string, now time.Time) (session.Session, int, time.Time) {
+	ses, err := slf.sm.GetSession(loginFailurePrefix + id)
+	if err != nil {
+		return nil, 0, time.Time{}
+	}
+	value, _ := loadString(ses, failureKeyLockedUntil)
+	until, _ := strconv.ParseInt(value, 10, 64)
+	lockedUntil := time.Unix(0, until)
+	value, _ = loadString(ses, failureKeyLastFailure)
+	last, _ := strconv.ParseInt(value, 10, 64)
+	if now.Sub(time.Unix(0, last)) > slf.lockoutOptions.ResetAfter && !now.Before(lockedUntil) {
+		return ses, 0, time.Time{}
+	}
+	value, _ = loadString(ses, failureKeyCount)
+	count, _ := strconv.Atoi(value)
+	return ses, count, lockedUntil
+}
+
+// 清零失败计数
+func (slf *auth) resetLoginFailure(id string) error {
+	ses, err := slf.sm.GetSession(loginFailurePrefix + id)
+	if err != nil {
+		return nil
+	}
+	return slf.sm.UnRegisterSession(ses)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger 日志接口，args 为交替出现的键值对，如 "consumer", tag, "error", err
+//
+// 方法签名与 log/slog 一致，*slog.Logger 可直接使用，也可参考 NewSlogLogger；其他日志库（如 zap 的 SugaredLogger.Debugw 等）可简单包装后使用。
+// 日志中不会包含令牌、密码等凭证内容
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// 日志字段的键
+const (
+	logKeyConsumer = "consumer" // 消费者标记
+	logKeyClient   = "client"   // 客户端标记
+	logKeyUsername = "username" // 用户名
+	logKeyError    = "error"    // 错误
+)
+
+// WithLogger 使用特定的日志记录器，默认通过标准库 log 输出警告及错误日志，传入 nil 时不输出任何日志
+func WithLogger(logger Logger) Option {
+	return func(auth *auth) error {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		auth.logger = logger
+		return nil
+	}
+}
+
+// 默认日志记录器，通过标准库 log 输出警告及错误日志
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, args ...interface{}) {}
+
+func (stdLogger) Info(msg string, args ...interface{}) {}
+
+func (stdLogger) Warn(msg string, args ...interface{}) {
+	log.Println(formatLog("WARN", msg, args))
+}
+
+func (stdLogger) Error(msg string, args ...interface{}) {
+	log.Println(formatLog("ERROR", msg, args))
+}
+
+// 不输出任何日志的日志记录器
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+
+func (nopLogger) Info(msg string, args ...interface{}) {}
+
+func (nopLogger) Warn(msg string, args ...interface{}) {}
+
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// 格式化为 level msg key=value 的形式
+func formatLog(level string, msg string, args []interface{}) string {
+	var builder strings.Builder
+	builder.WriteString(level)
+	builder.WriteString(" ")
+	builder.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		builder.WriteString(" ")
+		if i+1 < len(args) {
+			builder.WriteString(fmt.Sprintf("%v=%v", args[i], args[i+1]))
+		} else {
+			builder.WriteString(fmt.Sprintf("%v", args[i]))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,11 @@
+package auth
+
+import "log/slog"
+
+// NewSlogLogger 使用 log/slog 记录日志，logger 为空时使用 slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger
+}
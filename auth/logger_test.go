@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kercylan98/go-session/session"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (slf *testLogger) log(level string, msg string, args []interface{}) {
+	slf.Lock()
+	slf.lines = append(slf.lines, formatLog(level, msg, args))
+	slf.Unlock()
+}
+
+func (slf *testLogger) Debug(msg string, args ...interface{}) { slf.log("DEBUG", msg, args) }
+
+func (slf *testLogger) Info(msg string, args ...interface{}) { slf.log("INFO", msg, args) }
+
+func (slf *testLogger) Warn(msg string, args ...interface{}) { slf.log("WARN", msg, args) }
+
+func (slf *testLogger) Error(msg string, args ...interface{}) { slf.log("ERROR", msg, args) }
+
+func (slf *testLogger) String() string {
+	slf.Lock()
+	defer slf.Unlock()
+	return strings.Join(slf.lines, "\n")
+}
+
+type failedAuditSink struct{}
+
+func (failedAuditSink) Append(record AuditRecord) error {
+	return errors.New("disk full")
+}
+
+func TestAuth_Logger(t *testing.T) {
+	logger := new(testLogger)
+	auth, err := New(session.NewManagerMemory(), WithLogger(logger), WithAuditSink(failedAuditSink{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetAllowManyClient(nil)
+	var next int
+	auth.SetAllowManyClient(func() string {
+		next++
+		return fmt.Sprint("web", next)
+	})
+	auth.AddTempAccount("admin", "12345")
+
+	consumer, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = consumer.VerifyToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := auth.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, _ := other.GetToken()
+	if err = consumer.VerifyToken(otherToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatal("expect invalid token, got", err)
+	}
+	if consumer.CheckToken("broken") {
+		t.Fatal("broken token should be invalid")
+	}
+	if err = consumer.OutLogin(); err != nil {
+		t.Fatal(err)
+	}
+	if err = consumer.VerifyToken(token); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatal("expect not logged in, got", err)
+	}
+
+	output := logger.String()
+	for _, expect := range []string{
+		"WARN set allow many client failed, client tag getter is nil",
+		"ERROR append audit record failed sink=0 action=login_succeeded username=admin error=disk full",
+		fmt.Sprintf("DEBUG check token failed consumer=%s client=web1 error=", consumer.GetTag()),
+	} {
+		if !strings.Contains(output, expect) {
+			t.Fatalf("expect log %q, got:\n%s", expect, output)
+		}
+	}
+	// 日志不应包含令牌
+	if strings.Contains(output, token) || strings.Contains(output, otherToken) {
+		t.Fatal("token leaked into logs:\n", output)
+	}
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"time"
 )
 
 // LoginModeSelector 登录模式选择器
@@ -10,57 +12,182 @@ type LoginModeSelector interface {
 	Password(username string, password string) (Consumer, error)
 	// UsePasswordChecker 使用验证器（可多个），不使用的情况下，则在内存中进行验证
 	UsePasswordChecker(checker ...func(username string, password string) error) LoginModeSelector
+	// UsePasswordCheckerContext 同 UsePasswordChecker，验证器将接收 Auth.LoginContext 传入的 ctx
+	UsePasswordCheckerContext(checker ...func(ctx context.Context, username string, password string) error) LoginModeSelector
+	// UseSourceIP 设置登录请求的来源IP，启用 WithLockout 时将同时按来源IP统计密码、二次验证及验证码的失败次数
+	UseSourceIP(ip string) LoginModeSelector
+	// UseDevice 设置登录的设备信息，可通过 Auth.ListSessions 查看。IP 为空时使用 UseSourceIP 设置的来源IP，登录时间将自动记录
+	UseDevice(device Device) LoginModeSelector
+	// TOTP 使用 Password 或 VerifyCode 返回的 *MFARequiredError 中的挑战id及TOTP一次性密码（或恢复码）完成登录
+	TOTP(challengeId string, code string) (Consumer, error)
+	// Code 向用户发送一次性登录验证码（需通过 WithCodeSender 启用）
+	Code(username string) error
+	// VerifyCode 使用一次性登录验证码完成登录，已绑定二次验证的用户同 Password 返回 *MFARequiredError
+	VerifyCode(username string, code string) (Consumer, error)
+	// OIDC 使用 OpenID Connect 身份提供方进行授权码登录
+	OIDC(provider *OIDCProvider) OIDCFlow
 }
 
-func newLoginModeSelector(auth Auth) LoginModeSelector {
+func newLoginModeSelector(auth Auth, ctx context.Context) LoginModeSelector {
 	return &loginModeSelector{
 		auth:            auth,
+		ctx:             ctx,
 		passwordChecker: nil,
 	}
 }
 
 type loginModeSelector struct {
 	auth            Auth
-	passwordChecker []func(username string, password string) error
+	ctx             context.Context // 登录请求的上下文
+	passwordChecker []func(ctx context.Context, username string, password string) error
+	sourceIP        string // 登录请求的来源IP
+	device          Device // 登录的设备信息
 }
 
 func (slf *loginModeSelector) UsePasswordChecker(checker ...func(username string, password string) error) LoginModeSelector {
+	if checker == nil {
+		slf.passwordChecker = nil
+		return slf
+	}
+	slf.passwordChecker = make([]func(ctx context.Context, username string, password string) error, 0, len(checker))
+	for _, f := range checker {
+		f := f
+		slf.passwordChecker = append(slf.passwordChecker, func(ctx context.Context, username string, password string) error {
+			return f(username, password)
+		})
+	}
+	return slf
+}
+
+func (slf *loginModeSelector) UsePasswordCheckerContext(checker ...func(ctx context.Context, username string, password string) error) LoginModeSelector {
 	slf.passwordChecker = checker
 	return slf
 }
 
+func (slf *loginModeSelector) UseSourceIP(ip string) LoginModeSelector {
+	slf.sourceIP = ip
+	return slf
+}
+
+func (slf *loginModeSelector) UseDevice(device Device) LoginModeSelector {
+	slf.device = device
+	return slf
+}
+
 func (slf *loginModeSelector) Password(username string, password string) (Consumer, error) {
+	if err := slf.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := slf.checkPassword(username, password); err != nil {
+		return nil, slf.failed(username, err)
+	}
+	return slf.firstFactorPassed(username)
+}
+
+// 第一因素验证通过后完成登录，已绑定二次验证的用户需要完成二次验证后才能登录，失败次数在二次验证通过后清零
+func (slf *loginModeSelector) firstFactorPassed(username string) (Consumer, error) {
+	required, err := slf.auth.mfaRequired(username)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		challengeId, err := slf.auth.newMFAChallenge(username)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &MFARequiredError{ChallengeID: challengeId}
+	}
+	slf.auth.loginSucceeded(username)
+	return slf.login(username)
+}
+
+// 检查锁定状态并校验密码，凭证错误时记录一次失败
+//
+// 同一用户的检查、校验及记录串行执行，避免并发猜测在失败被记录前全部通过锁定检查
+func (slf *loginModeSelector) checkPassword(username string, password string) error {
+	unlock := slf.auth.lockLogin(username)
+	defer unlock()
+	// 锁定期间不再校验密码
+	if err := slf.auth.checkLockout(username, slf.sourceIP); err != nil {
+		return err
+	}
+	var err error
 	if slf.passwordChecker != nil {
 		for _, f := range slf.passwordChecker {
-			if err := f(username, password); err != nil {
-				return nil, err
+			if err = f(slf.ctx, username, password); err != nil {
+				// 请求已取消时直接返回，未归类的验证器错误视为凭证错误
+				if ctxErr := slf.ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				err = wrapError(ErrInvalidCredentials, err)
+				break
 			}
 		}
-		goto loginSuccess
+	} else {
+		err = slf.tempLoginCheck(username, password)
 	}
-	if err := slf.tempLoginCheck(username, password); err != nil {
-		return nil, err
+	// 存储不可用等错误不计入失败次数
+	if errors.Is(err, ErrInvalidCredentials) {
+		slf.auth.loginFailed(username, slf.sourceIP)
 	}
+	return err
+}
 
-loginSuccess:
-	{
-		var tag = "__x_x__once"
-		if slf.auth.getAllowManyClient() {
-			tag = slf.auth.getAllowManyClientFunc()()
-		}
-		consumer := newConsumer(slf.auth, username, tag)
-		if err := slf.auth.join(consumer); err != nil {
-			return nil, err
-		}
-		return consumer, nil
+func (slf *loginModeSelector) TOTP(challengeId string, code string) (Consumer, error) {
+	username, err := slf.auth.verifyMFAChallenge(challengeId, code, slf.sourceIP)
+	if err != nil {
+		return nil, slf.failed(username, err)
 	}
+	slf.auth.loginSucceeded(username)
+	return slf.login(username)
 }
 
-func (slf *loginModeSelector) tempLoginCheck(username string, password string) error {
-	if p, exist := slf.auth.getTempAccount()[username]; exist {
-		if p == password {
-			return nil
+func (slf *loginModeSelector) Code(username string) error {
+	return slf.auth.sendLoginCode(username)
+}
+
+func (slf *loginModeSelector) VerifyCode(username string, code string) (Consumer, error) {
+	if err := slf.auth.verifyLoginCode(username, code, slf.sourceIP); err != nil {
+		return nil, slf.failed(username, err)
+	}
+	return slf.firstFactorPassed(username)
+}
+
+func (slf *loginModeSelector) OIDC(provider *OIDCProvider) OIDCFlow {
+	return newOIDCFlow(slf, provider)
+}
+
+// 通知登录失败并返回原错误，请求已取消时不通知
+func (slf *loginModeSelector) failed(username string, err error) error {
+	if slf.ctx.Err() == nil {
+		device := slf.device
+		if device.IP == "" {
+			device.IP = slf.sourceIP
 		}
+		slf.auth.notify(slf.ctx, Event{Type: EventLoginFailed, Username: username, Device: device, Err: err})
+	}
+	return err
+}
+
+// 验证通过后使消费者加入认证器，加入失败（如钩子拒绝、客户端数量超限、存储不可用）时同样通知登录失败
+func (slf *loginModeSelector) login(username string) (Consumer, error) {
+	var tag = "__x_x__once"
+	if slf.auth.getAllowManyClient() {
+		tag = slf.auth.getAllowManyClientFunc()()
 	}
-	return errors.New("the account does not exist or the login password is wrong")
+	consumer := newConsumer(slf.auth, username, tag)
+	consumer.Device = slf.device
+	if consumer.Device.IP == "" {
+		consumer.Device.IP = slf.sourceIP
+	}
+	consumer.Device.LoginAt = time.Now()
+	consumer.Device.LastSeenAt = consumer.Device.LoginAt
+	if err := slf.auth.join(slf.ctx, consumer); err != nil {
+		return nil, slf.failed(username, err)
+	}
+	return consumer, nil
+}
+
+func (slf *loginModeSelector) tempLoginCheck(username string, password string) error {
+	return slf.auth.verifyTempAccount(username, password)
 }
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"path"
+	"strings"
+)
+
+// 资源URI匹配器，按 / 拆分的路径段构建前缀树，匹配耗时只与URI的段数相关，与资源数量无关
+//
+// 模式中的路径段支持：
+//   - 静态段：完全相等，如 api
+//   - 段内通配：包含 * ? [ 的段按 path.Match 匹配单个段，如 user-*、*:
+//   - 单段通配：* 或 {name}，匹配任意单个非空段
+//   - 多段通配：**，匹配零个或多个段
+//
+// 多个模式同时匹配时，按从左到右逐段比较，静态段 > 段内通配 > 单段通配 > 多段通配，优先返回更具体的模式
+type resourceMatcher struct {
+	root *matcherNode
+}
+
+type matcherNode struct {
+	static map[string]*matcherNode // 静态段子节点
+	globs  []*matcherGlob          // 段内通配子节点
+	param  *matcherNode            // 单段通配子节点
+	any    *matcherNode            // 多段通配子节点
+	index  int                     // 终止于该节点的资源下标，-1 表示不存在
+}
+
+type matcherGlob struct {
+	glob string
+	node *matcherNode
+}
+
+func newResourceMatcher() *resourceMatcher {
+	return &resourceMatcher{root: newMatcherNode()}
+}
+
+func newMatcherNode() *matcherNode {
+	return &matcherNode{index: -1}
+}
+
+// 添加模式，同一模式重复添加时保留首次添加的下标
+func (slf *resourceMatcher) add(pattern string, index int) {
+	node := slf.root
+	for _, segment := range strings.Split(pattern, "/") {
+		switch {
+		case segment == "**":
+			if node.any == nil {
+				node.any = newMatcherNode()
+			}
+			node = node.any
+		case segment == "*" || (strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")):
+			if node.param == nil {
+				node.param = newMatcherNode()
+			}
+			node = node.param
+		case strings.ContainsAny(segment, "*?["):
+			var child *matcherNode
+			for _, g := range node.globs {
+				if g.glob == segment {
+					child = g.node
+					break
+				}
+			}
+			if child == nil {
+				child = newMatcherNode()
+				node.globs = append(node.globs, &matcherGlob{glob: segment, node: child})
+			}
+			node = child
+		default:
+			if node.static == nil {
+				node.static = map[string]*matcherNode{}
+			}
+			child, exist := node.static[segment]
+			if !exist {
+				child = newMatcherNode()
+				node.static[segment] = child
+			}
+			node = child
+		}
+	}
+	if node.index < 0 {
+		node.index = index
+	}
+}
+
+// 匹配URI，返回最具体的模式对应的下标
+func (slf *resourceMatcher) match(uri string) (int, bool) {
+	return slf.root.match(strings.Split(uri, "/"))
+}
+
+func (slf *matcherNode) match(segments []string) (int, bool) {
+	if len(segments) == 0 {
+		if slf.index >= 0 {
+			return slf.index, true
+		}
+		if slf.any != nil {
+			return slf.any.match(segments)
+		}
+		return -1, false
+	}
+	segment, rest := segments[0], segments[1:]
+	if child, exist := slf.static[segment]; exist {
+		if index, ok := child.match(rest); ok {
+			return index, true
+		}
+	}
+	for _, g := range slf.globs {
+		if matched, _ := path.Match(g.glob, segment); matched {
+			if index, ok := g.node.match(rest); ok {
+				return index, true
+			}
+		}
+	}
+	if slf.param != nil && segment != "" {
+		if index, ok := slf.param.match(rest); ok {
+			return index, true
+		}
+	}
+	if slf.any != nil {
+		for i := 0; i <= len(segments); i++ {
+			if index, ok := slf.any.match(segments[i:]); ok {
+				return index, true
+			}
+		}
+	}
+	return -1, false
+}
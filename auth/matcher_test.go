@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResourceMatcher(t *testing.T) {
+	helper := &RoleHelper{}
+	group := helper.NewResourceGroup("api").Add(
+		helper.NewResource("user detail", "get:/api/user/detail"),
+		helper.NewResource("get user", "get:/api/user/{id}"),
+		helper.NewResource("read user", "get:/api/user/**"),
+		helper.NewResource("project", "/api/project/*"),
+		helper.NewResource("any method", "*:/api/health"),
+		helper.NewResource("report", "get:/api/report-*/export"),
+	)
+	for _, c := range []struct {
+		uri  string
+		name string
+	}{
+		{"get:/api/user/detail", "user detail"},
+		{"get:/api/user/42", "get user"},
+		{"get:/api/user/42/roles", "read user"},
+		{"get:/api/user", "read user"},
+		{"/api/project/1", "project"},
+		{"post:/api/health", "any method"},
+		{"get:/api/report-2024/export", "report"},
+	} {
+		r, ok := group.Match(c.uri)
+		if !ok || r.GetName() != c.name {
+			t.Fatalf("%s: expect %s, got %v", c.uri, c.name, r)
+		}
+	}
+	for _, uri := range []string{
+		"post:/api/user/42",
+		"get:/api/users",
+		"/api/project/1/member",
+		"/api/project/",
+		"get:/api/report/export",
+	} {
+		if group.Exist(uri) {
+			t.Fatalf("%s: expect no match", uri)
+		}
+	}
+
+	role := helper.NewRole("admin").AddResourceGroup(group)
+	if !role.Exist("get:/api/user/42", "post:/api/health") || role.Exist("get:/api/user/42", "post:/api/user") {
+		t.Fatal("role exist mismatch")
+	}
+
+	// 经过序列化后依旧可以匹配
+	data, err := json.Marshal([]Role{role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var model roleModel
+	if err = json.Unmarshal(data, &model); err != nil {
+		t.Fatal(err)
+	}
+	if roles := model.toRoles(); !roles[0].Exist("get:/api/user/42/roles") {
+		t.Fatal("restored role should match wildcard resource")
+	}
+
+	// 授权范围在构建消费者时编译
+	consumer := newConsumer(nil, "admin", "")
+	consumer.setScopes([]string{"get:/api/**", "post:/api/user"})
+	if consumer.scopeMatcher == nil {
+		t.Fatal("scopes should be compiled")
+	}
+	for uri, inScope := range map[string]bool{"get:/api/user": true, "post:/api/user": true, "post:/api/role": false} {
+		if _, ok := consumer.scopeMatcher.match(uri); ok != inScope {
+			t.Fatal("scope match mismatch", uri)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mfaChallengePrefix = "__x_x__mfa_challenge:" // 二次验证挑战会话id前缀
+	mfaChallengeExpire = 5 * time.Minute         // 二次验证挑战有效期
+	mfaFailurePrefix   = "__x_x__mfa_failure:"   // 二次验证失败计数会话id前缀
+	mfaMaxFailures     = 5                       // 每个用户在 mfaFailureWindow 内允许的二次验证失败次数
+	mfaFailureWindow   = 15 * time.Minute        // 二次验证失败计数窗口，达到最大失败次数后锁定至窗口结束
+
+	challengeKeyUsername = "username" // 挑战所属用户名
+	challengeKeyExpire   = "expire"   // 挑战过期时间
+	mfaFailureKeyUntil   = "until"    // 失败计数窗口的结束时间
+)
+
+// MFAStore 二次验证绑定信息存储
+type MFAStore interface {
+	// GetSecret 获取用户绑定的TOTP密钥，未绑定时返回空字符串
+	GetSecret(username string) (string, error)
+	// UseRecoveryCode 消耗用户的恢复码，恢复码有效时返回 true，每个恢复码只能使用一次
+	UseRecoveryCode(username string, code string) (bool, error)
+	// UseStep 记录用户最近一次使用的TOTP时间步，时间步不大于已记录的值时返回 false，用于防止一次性密码被重放
+	UseStep(username string, step int64) (bool, error)
+}
+
+// WithMFA 启用TOTP二次验证，已在 store 中绑定密钥的用户在密码验证通过后需通过 LoginModeSelector.TOTP 完成登录
+func WithMFA(store MFAStore) Option {
+	return func(auth *auth) error {
+		auth.mfaStore = store
+		return nil
+	}
+}
+
+// NewMemoryMFAStore 创建一个基于内存的二次验证绑定信息存储
+func NewMemoryMFAStore() *MemoryMFAStore {
+	return &MemoryMFAStore{
+		secrets:       map[string]string{},
+		recoveryCodes: map[string]map[string]bool{},
+		steps:         map[string]int64{},
+	}
+}
+
+// MemoryMFAStore 基于内存的二次验证绑定信息存储
+type MemoryMFAStore struct {
+	sync.Mutex
+	secrets       map[string]string          // 用户TOTP密钥
+	recoveryCodes map[string]map[string]bool // 用户恢复码摘要
+	steps         map[string]int64           // 用户最近一次使用的时间步
+}
+
+// Enroll 为用户绑定TOTP密钥及恢复码，将覆盖原有绑定
+func (slf *MemoryMFAStore) Enroll(username string, secret string, recoveryCodes ...string) {
+	slf.Lock()
+	defer slf.Unlock()
+	slf.secrets[username] = secret
+	slf.recoveryCodes[username] = map[string]bool{}
+	for _, code := range recoveryCodes {
+		slf.recoveryCodes[username][recoveryCodeDigest(code)] = true
+	}
+	delete(slf.steps, username)
+}
+
+// Unenroll 解除用户的二次验证绑定
+func (slf *MemoryMFAStore) Unenroll(username string) {
+	slf.Lock()
+	defer slf.Unlock()
+	delete(slf.secrets, username)
+	delete(slf.recoveryCodes, username)
+	delete(slf.steps, username)
+}
+
+// GetSecret 获取用户绑定的TOTP密钥
+func (slf *MemoryMFAStore) GetSecret(username string) (string, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	return slf.secrets[username], nil
+}
+
+// UseRecoveryCode 消耗用户的恢复码
+func (slf *MemoryMFAStore) UseRecoveryCode(username string, code string) (bool, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	digest := recoveryCodeDigest(code)
+	if slf.recoveryCodes[username][digest] {
+		delete(slf.recoveryCodes[username], digest)
+		return true, nil
+	}
+	return false, nil
+}
+
+// UseStep 记录用户最近一次使用的TOTP时间步
+func (slf *MemoryMFAStore) UseStep(username string, step int64) (bool, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	if last, exist := slf.steps[username]; exist && step <= last {
+		return false, nil
+	}
+	slf.steps[username] = step
+	return true, nil
+}
+
+// 恢复码摘要，存储时不保留明文
+func recoveryCodeDigest(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// 检查用户是否需要二次验证
+func (slf *auth) mfaRequired(username string) (bool, error) {
+	if slf.mfaStore == nil {
+		return false, nil
+	}
+	secret, err := slf.mfaStore.GetSecret(username)
+	if err != nil {
+		return false, wrapError(ErrStore, err)
+	}
+	return secret != "", nil
+}
+
+// 为用户创建二次验证挑战
+func (slf *auth) newMFAChallenge(username string) (string, error) {
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challengeId := hex.EncodeToString(b)
+	ses, err := slf.sm.RegisterSession(mfaChallengePrefix + challengeId)
+	if err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	for key, value := range map[string]string{
+		challengeKeyUsername: username,
+		challengeKeyExpire:   strconv.FormatInt(time.Now().Add(mfaChallengeExpire).Unix(), 10),
+	} {
+		if err = ses.Store(key, value); err != nil {
+			return "", wrapError(ErrStore, err)
+		}
+	}
+	return challengeId, nil
+}
+
+// 校验二次验证挑战，成功后挑战将被销毁并返回挑战所属的用户名
+//
+// 失败次数按用户计数而非按挑战计数，重新进行密码登录不会重置；同一用户的校验串行执行，并发猜测同样受失败次数限制。
+// 启用 WithLockout 时，失败同样计入用户名及来源IP的登录失败次数
+func (slf *auth) verifyMFAChallenge(challengeId string, code string, ip string) (string, error) {
+	if slf.mfaStore == nil {
+		return "", newError(ErrNotEnabled, "mfa is not enabled")
+	}
+	ses, err := slf.sm.GetSession(mfaChallengePrefix + challengeId)
+	if err != nil {
+		if err = sessionError(err); errors.Is(err, ErrNotLoggedIn) {
+			return "", newError(ErrInvalidCredentials, "mfa challenge does not exist or has expired")
+		}
+		return "", err
+	}
+	username, err := loadString(ses, challengeKeyUsername)
+	if err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	expire, err := loadString(ses, challengeKeyExpire)
+	if err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	if expireAt, _ := strconv.ParseInt(expire, 10, 64); time.Now().Unix() >= expireAt {
+		_ = slf.sm.UnRegisterSession(ses)
+		return username, newError(ErrInvalidCredentials, "mfa challenge does not exist or has expired")
+	}
+
+	unlock := slf.mfaLocks.Lock(username)
+	defer unlock()
+	if err = slf.checkLockout(username, ip); err != nil {
+		return username, err
+	}
+	now := time.Now()
+	failure, count, until := slf.loadMFAFailure(username, now)
+	if count >= mfaMaxFailures {
+		return username, &AccountLockedError{Until: until}
+	}
+
+	secret, err := slf.mfaStore.GetSecret(username)
+	if err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	var passed bool
+	if step, ok := validateTOTP(secret, code, now); ok {
+		if passed, err = slf.mfaStore.UseStep(username, step); err != nil {
+			return "", wrapError(ErrStore, err)
+		}
+	} else if passed, err = slf.mfaStore.UseRecoveryCode(username, code); err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+
+	if !passed {
+		slf.loginFailed(username, ip)
+		if failure == nil {
+			if failure, err = slf.sm.RegisterSession(mfaFailurePrefix + username); err != nil {
+				return "", wrapError(ErrStore, err)
+			}
+			until = now.Add(mfaFailureWindow)
+		}
+		count++
+		for key, value := range map[string]string{
+			failureKeyCount:    strconv.Itoa(count),
+			mfaFailureKeyUntil: strconv.FormatInt(until.UnixNano(), 10),
+		} {
+			if err = failure.Store(key, value); err != nil {
+				return "", wrapError(ErrStore, err)
+			}
+		}
+		if count >= mfaMaxFailures {
+			_ = slf.sm.UnRegisterSession(ses)
+			return username, newError(ErrInvalidCredentials, "too many failed mfa attempts, please try again later")
+		}
+		return username, newError(ErrInvalidCredentials, "invalid mfa code")
+	}
+	if failure != nil {
+		_ = slf.sm.UnRegisterSession(failure)
+	}
+	if err = slf.sm.UnRegisterSession(ses); err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	return username, nil
+}
+
+// 载入用户的二次验证失败计数，不存在时返回空会话，计数窗口结束后失败次数视为0
+func (slf *auth) loadMFAFailure(username string, now time.Time) (session.Session, int, time.Time) {
+	ses, err := slf.sm.GetSession(mfaFailurePrefix + username)
+	if err != nil {
+		return nil, 0, time.Time{}
+	}
+	value, _ := loadString(ses, mfaFailureKeyUntil)
+	nano, _ := strconv.ParseInt(value, 10, 64)
+	until := time.Unix(0, nano)
+	if !now.Before(until) {
+		return ses, 0, now.Add(mfaFailureWindow)
+	}
+	value, _ = loadString(ses, failureKeyCount)
+	count, _ := strconv.Atoi(value)
+	return ses, count, until
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 附录D 测试向量
+	secret := otpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for counter, expect := range []string{"755224", "287082", "359152", "969429", "338314"} {
+		code, err := HOTP(secret, uint64(counter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expect {
+			t.Fatalf("counter %d: expect %s, got %s", counter, expect, code)
+		}
+	}
+}
+
+func TestAuth_TOTP(t *testing.T) {
+	store := NewMemoryMFAStore()
+	auth, err := New(session.NewManagerMemory(), WithMFA(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Enroll("admin", secret, recoveryCodes...)
+	t.Log(TOTPURI("go-auth", "admin", secret))
+
+	// 密码验证通过后返回二次验证挑战
+	_, err = auth.Login().Password("admin", "12345")
+	var mfaErr *MFARequiredError
+	if !errors.Is(err, ErrMFARequired) || !errors.As(err, &mfaErr) {
+		t.Fatal("expect mfa required, got", err)
+	}
+	if _, err = auth.Login().TOTP(mfaErr.ChallengeID, "abcdef"); err == nil {
+		t.Fatal("invalid code should be rejected")
+	}
+
+	code, err := TOTP(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, err := auth.Login().TOTP(mfaErr.ChallengeID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsLogin(consumer) {
+		t.Fatal("consumer should be logged in")
+	}
+
+	// 挑战只能使用一次，一次性密码不可重放
+	if _, err = auth.Login().TOTP(mfaErr.ChallengeID, code); err == nil {
+		t.Fatal("challenge should be consumed")
+	}
+	_, err = auth.Login().Password("admin", "12345")
+	if !errors.As(err, &mfaErr) {
+		t.Fatal("expect mfa required, got", err)
+	}
+	if _, err = auth.Login().TOTP(mfaErr.ChallengeID, code); err == nil {
+		t.Fatal("totp code should not be replayed")
+	}
+
+	// 恢复码
+	if _, err = auth.Login().TOTP(mfaErr.ChallengeID, strings.ToUpper(recoveryCodes[0])); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuth_TOTPFailures(t *testing.T) {
+	store := NewMemoryMFAStore()
+	auth, err := New(session.NewManagerMemory(), WithMFA(store), WithLockout(LockoutOptions{
+		FreeAttempts:    3,
+		MaxAttempts:     4,
+		LockoutDuration: time.Hour,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := func(username string) string {
+		var mfaErr *MFARequiredError
+		if _, err := auth.Login().Password(username, "12345"); !errors.As(err, &mfaErr) {
+			t.Fatal("expect mfa required, got", err)
+		}
+		return mfaErr.ChallengeID
+	}
+
+	// 失败次数按用户计数，重新密码登录获取新的挑战不会重置
+	auth.AddTempAccount("admin", "12345")
+	store.Enroll("admin", secret)
+	for i := 0; i < mfaMaxFailures; i++ {
+		if _, err = auth.Login().TOTP(challenge("admin"), "abcdef"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("expect invalid credentials, got", err)
+		}
+		_ = auth.UnlockAccount("admin")
+	}
+	code, err := TOTP(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Login().TOTP(challenge("admin"), code); !errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect mfa locked, got", err)
+	}
+
+	// 二次验证失败计入登录锁定，密码正确但未完成二次验证时不会清零
+	auth.AddTempAccount("guest", "12345")
+	store.Enroll("guest", secret)
+	for i := 0; i < 2; i++ {
+		if _, err = auth.Login().Password("guest", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("expect invalid credentials, got", err)
+		}
+	}
+	id := challenge("guest")
+	for i := 0; i < 2; i++ {
+		if _, err = auth.Login().TOTP(id, "abcdef"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("expect invalid credentials, got", err)
+		}
+	}
+	if _, err = auth.Login().Password("guest", "12345"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatal("expect account locked, got", err)
+	}
+}
+
+type failedMFAStore struct {
+	*MemoryMFAStore
+}
+
+func (failedMFAStore) UseStep(username string, step int64) (bool, error) {
+	return false, errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+}
+
+func TestAuth_MFAStoreFailure(t *testing.T) {
+	store := failedMFAStore{NewMemoryMFAStore()}
+	auth, err := New(session.NewManagerMemory(), WithMFA(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AddTempAccount("admin", "12345")
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Enroll("admin", secret)
+
+	_, err = auth.Login().Password("admin", "12345")
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatal("expect mfa required, got", err)
+	}
+	code, err := TOTP(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 存储不可用不视为验证码错误
+	if _, err = auth.Login().TOTP(mfaErr.ChallengeID, code); !errors.Is(err, ErrStore) || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal("expect store error, got", err)
+	}
+}
+
+func TestAuth_CodeMFA(t *testing.T) {
+	store := NewMemoryMFAStore()
+	sender := NewMemorySender()
+	auth, err := New(session.NewManagerMemory(), WithMFA(store), WithCodeSender(sender, CodeOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Enroll("admin", secret)
+
+	// 验证码登录同样需要完成二次验证
+	if err = auth.Login().Code("admin"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.Login().VerifyCode("admin", sender.GetCode("admin"))
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatal("expect mfa required, got", err)
+	}
+	code, err := TOTP(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, err := auth.Login().TOTP(mfaErr.ChallengeID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsLogin(consumer) {
+		t.Fatal("consumer should be logged in")
+	}
+}
@@ -0,0 +1,383 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcStatePrefix = "__x_x__oidc_state:" // OIDC授权状态会话id前缀
+	oidcStateExpire = 10 * time.Minute     // OIDC授权状态有效期
+	oidcClockSkew   = time.Minute          // 校验ID令牌时间时允许的时钟偏差
+
+	oidcKeyNonce    = "nonce"    // 授权请求的nonce
+	oidcKeyVerifier = "verifier" // PKCE code_verifier
+	oidcKeyExpire   = "expire"   // 授权状态过期时间
+)
+
+// OIDCProvider OpenID Connect 身份提供方配置
+type OIDCProvider struct {
+	Issuer                string   // 签发者，ID令牌中的 iss 必须与之一致
+	ClientID              string   // 客户端id
+	ClientSecret          string   // 客户端密钥，为空时视为公开客户端
+	RedirectURL           string   // 授权回调地址
+	Scopes                []string // 授权范围，默认 openid、profile、email
+	AuthorizationEndpoint string   // 授权端点，为空时可通过 Discover 获取
+	TokenEndpoint         string   // 令牌端点，为空时可通过 Discover 获取
+	JWKSURI               string   // JWKS地址，为空时可通过 Discover 获取
+	UsernameClaim         string   // 作为用户名的声明，默认 sub
+
+	// ClaimsMapper 自定义将ID令牌声明映射为用户名，设置后 UsernameClaim 将被忽略
+	ClaimsMapper func(claims map[string]interface{}) (string, error)
+	// HTTPClient 请求身份提供方使用的客户端，默认 http.DefaultClient
+	HTTPClient *http.Client
+
+	jwksLock sync.Mutex // 保护jwks缓存
+	jwks     []*Key     // 已缓存的身份提供方公钥，仅包含RSA公钥
+}
+
+// Discover 通过 {Issuer}/.well-known/openid-configuration 补全未配置的端点
+func (slf *OIDCProvider) Discover() error {
+	var config struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := slf.getJson(strings.TrimSuffix(slf.Issuer, "/")+"/.well-known/openid-configuration", &config); err != nil {
+		return err
+	}
+	if config.Issuer != slf.Issuer {
+		return errors.New("oidc discovery issuer mismatch: " + config.Issuer)
+	}
+	if slf.AuthorizationEndpoint == "" {
+		slf.AuthorizationEndpoint = config.AuthorizationEndpoint
+	}
+	if slf.TokenEndpoint == "" {
+		slf.TokenEndpoint = config.TokenEndpoint
+	}
+	if slf.JWKSURI == "" {
+		slf.JWKSURI = config.JWKSURI
+	}
+	return nil
+}
+
+// 获取http客户端
+func (slf *OIDCProvider) client() *http.Client {
+	if slf.HTTPClient != nil {
+		return slf.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// 请求并解析json响应
+func (slf *OIDCProvider) getJson(uri string, v interface{}) error {
+	resp, err := slf.client().Get(uri)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	defer resp.Body.Close()
+	return decodeOIDCResponse(resp, v)
+}
+
+// 根据密钥id获取身份提供方公钥，未命中缓存时将重新拉取JWKS
+//
+// JWKS中的对称密钥（oct）将被忽略，避免接受以公开发布的密钥签名的 HS256 ID令牌
+func (slf *OIDCProvider) lookupKey(ctx context.Context, kid string) (*Key, error) {
+	slf.jwksLock.Lock()
+	defer slf.jwksLock.Unlock()
+	for refreshed := false; ; refreshed = true {
+		for _, key := range slf.jwks {
+			if key.ID == kid || (kid == "" && len(slf.jwks) == 1) {
+				return key, nil
+			}
+		}
+		if refreshed {
+			return nil, errors.New("no oidc provider key found with key id: " + kid)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, slf.JWKSURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := slf.client().Do(req)
+		if err != nil {
+			return nil, wrapError(ErrStore, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, wrapError(ErrStore, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, newError(ErrStore, "fetch oidc jwks failed, status: "+resp.Status)
+		}
+		keys, err := ParseJWKSet(data)
+		if err != nil {
+			return nil, err
+		}
+		var jwks []*Key
+		for _, key := range keys {
+			if key.PublicKey != nil {
+				jwks = append(jwks, key)
+			}
+		}
+		slf.jwks = jwks
+	}
+}
+
+// OIDCFlow OpenID Connect 授权码登录流程
+type OIDCFlow interface {
+	// AuthURL 生成携带 state、nonce 及 PKCE 参数的授权地址，返回授权地址及 state
+	AuthURL() (authURL string, state string, err error)
+	// Exchange 使用授权回调中的 state 及 code 换取并校验ID令牌后完成登录
+	Exchange(state string, code string) (Consumer, error)
+}
+
+func newOIDCFlow(selector *loginModeSelector, provider *OIDCProvider) *oidcFlow {
+	return &oidcFlow{
+		selector: selector,
+		provider: provider,
+	}
+}
+
+type oidcFlow struct {
+	selector *loginModeSelector
+	provider *OIDCProvider
+}
+
+func (slf *oidcFlow) AuthURL() (string, string, error) {
+	if slf.provider.AuthorizationEndpoint == "" {
+		return "", "", errors.New("oidc authorization endpoint is not configured")
+	}
+	state, err := newOIDCRandom()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newOIDCRandom()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newOIDCRandom()
+	if err != nil {
+		return "", "", err
+	}
+	if err = slf.selector.auth.saveOIDCState(state, nonce, verifier); err != nil {
+		return "", "", err
+	}
+
+	scopes := slf.provider.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", slf.provider.ClientID)
+	query.Set("redirect_uri", slf.provider.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	authURL, err := url.Parse(slf.provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	if authURL.RawQuery != "" {
+		authURL.RawQuery += "&"
+	}
+	authURL.RawQuery += query.Encode()
+	return authURL.String(), state, nil
+}
+
+func (slf *oidcFlow) Exchange(state string, code string) (Consumer, error) {
+	username, err := slf.exchange(state, code)
+	if err != nil {
+		return nil, slf.selector.failed(username, err)
+	}
+	return slf.selector.login(username)
+}
+
+// 使用授权码换取并校验ID令牌，返回用户名
+func (slf *oidcFlow) exchange(state string, code string) (string, error) {
+	nonce, verifier, err := slf.selector.auth.takeOIDCState(state)
+	if err != nil {
+		return "", wrapError(ErrInvalidCredentials, err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", slf.provider.RedirectURL)
+	form.Set("client_id", slf.provider.ClientID)
+	form.Set("code_verifier", verifier)
+	if slf.provider.ClientSecret != "" {
+		form.Set("client_secret", slf.provider.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(slf.selector.ctx, http.MethodPost, slf.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := slf.provider.client().Do(req)
+	if err != nil {
+		return "", wrapError(ErrStore, err)
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = decodeOIDCResponse(resp, &tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.IDToken == "" {
+		return "", errors.New("oidc token response does not contain id_token")
+	}
+
+	claims, err := slf.verifyIDToken(tokenResp.IDToken, nonce)
+	if err != nil {
+		return "", wrapError(ErrInvalidToken, err)
+	}
+	return slf.username(claims)
+}
+
+// 校验ID令牌的签名、签发者、受众、有效期及nonce
+func (slf *oidcFlow) verifyIDToken(idToken string, nonce string) (map[string]interface{}, error) {
+	var claims map[string]interface{}
+	lookup := func(kid string) (*Key, error) {
+		return slf.provider.lookupKey(slf.selector.ctx, kid)
+	}
+	if err := newJWTVerifier(lookup, "").verify(idToken, &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != slf.provider.Issuer {
+		return nil, errors.New("unexpected id token issuer: " + iss)
+	}
+	var audienceMatched bool
+	switch aud := claims["aud"].(type) {
+	case string:
+		audienceMatched = aud == slf.provider.ClientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == slf.provider.ClientID {
+				audienceMatched = true
+				break
+			}
+		}
+	}
+	if !audienceMatched {
+		return nil, errors.New("id token audience mismatch")
+	}
+	now := time.Now()
+	exp, _ := claims["exp"].(float64)
+	if !now.Before(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, errors.New("id token has expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(oidcClockSkew).Before(time.Unix(int64(iat), 0)) {
+		return nil, errors.New("id token issued in the future")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// 将ID令牌声明映射为用户名
+func (slf *oidcFlow) username(claims map[string]interface{}) (string, error) {
+	if slf.provider.ClaimsMapper != nil {
+		return slf.provider.ClaimsMapper(claims)
+	}
+	claim := slf.provider.UsernameClaim
+	if claim == "" {
+		claim = "sub"
+	}
+	username, _ := claims[claim].(string)
+	if username == "" {
+		return "", errors.New("id token does not contain username claim: " + claim)
+	}
+	return username, nil
+}
+
+// 保存授权状态
+func (slf *auth) saveOIDCState(state string, nonce string, verifier string) error {
+	ses, err := slf.sm.RegisterSession(oidcStatePrefix + state)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	for key, value := range map[string]string{
+		oidcKeyNonce:    nonce,
+		oidcKeyVerifier: verifier,
+		oidcKeyExpire:   strconv.FormatInt(time.Now().Add(oidcStateExpire).Unix(), 10),
+	} {
+		if err = ses.Store(key, value); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+	return nil
+}
+
+// 取出并销毁授权状态，每个state只能使用一次
+func (slf *auth) takeOIDCState(state string) (nonce string, verifier string, err error) {
+	ses, err := slf.sm.GetSession(oidcStatePrefix + state)
+	if err != nil {
+		if err = sessionError(err); errors.Is(err, ErrNotLoggedIn) {
+			return "", "", newError(ErrInvalidCredentials, "oidc state does not exist or has expired")
+		}
+		return "", "", err
+	}
+	defer func() {
+		_ = slf.sm.UnRegisterSession(ses)
+	}()
+	expire, err := loadString(ses, oidcKeyExpire)
+	if err != nil {
+		return "", "", wrapError(ErrStore, err)
+	}
+	if expireAt, _ := strconv.ParseInt(expire, 10, 64); time.Now().Unix() >= expireAt {
+		return "", "", newError(ErrInvalidCredentials, "oidc state does not exist or has expired")
+	}
+	if nonce, err = loadString(ses, oidcKeyNonce); err != nil {
+		return "", "", wrapError(ErrStore, err)
+	}
+	if verifier, err = loadString(ses, oidcKeyVerifier); err != nil {
+		return "", "", wrapError(ErrStore, err)
+	}
+	return nonce, verifier, nil
+}
+
+// 解析身份提供方的json响应，身份提供方拒绝请求（4xx）时返回 ErrInvalidCredentials，其余失败视为身份提供方不可用（ErrStore）
+func decodeOIDCResponse(resp *http.Response, v interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("oidc provider responded with status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+			return wrapError(ErrInvalidCredentials, err)
+		}
+		return wrapError(ErrStore, err)
+	}
+	return wrapError(ErrStore, json.Unmarshal(data, v))
+}
+
+// 生成state、nonce及code_verifier使用的随机字符串
+func newOIDCRandom() (string, error) {
+	var b = make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 进程内的模拟OIDC身份提供方
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key       *Key
+	secret    *Key // 同时发布在JWKS中的对称密钥
+	symmetric bool // 使用对称密钥签发ID令牌
+	clientId  string
+	username  string
+	challenge string // 授权请求中的 code_challenge
+	nonce     string // 授权请求中的 nonce
+}
+
+func newFakeOIDCProvider(t *testing.T, clientId string, username string) *fakeOIDCProvider {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newKey(&Key{ID: "fake-key", PrivateKey: privateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := newKey(&Key{ID: "fake-secret", Secret: []byte("fake-oidc-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeOIDCProvider{key: key, secret: secret, clientId: clientId, username: username}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"jwks_uri":               provider.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(privateKey.E)).Bytes()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": key.ID,
+				"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(e),
+			}, {
+				"kty": "oct",
+				"kid": secret.ID,
+				"k":   base64.RawURLEncoding.EncodeToString(secret.Secret),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "fake-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != provider.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		now := time.Now()
+		signKey := key
+		if provider.symmetric {
+			signKey = secret
+		}
+		idToken, err := signJWT(signKey, map[string]interface{}{
+			"iss":   provider.URL,
+			"aud":   provider.clientId,
+			"sub":   "fake-subject",
+			"email": provider.username,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": provider.nonce,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+// 模拟用户在身份提供方完成授权
+func (slf *fakeOIDCProvider) authorize(authURL string) {
+	u, _ := url.Parse(authURL)
+	slf.challenge = u.Query().Get("code_challenge")
+	slf.nonce = u.Query().Get("nonce")
+}
+
+func TestLoginModeSelector_OIDC(t *testing.T) {
+	fake := newFakeOIDCProvider(t, "go-auth", "admin@example.com")
+	defer fake.Close()
+
+	auth, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &OIDCProvider{
+		Issuer:        fake.URL,
+		ClientID:      "go-auth",
+		RedirectURL:   "http://localhost/callback",
+		UsernameClaim: "email",
+	}
+	if err = provider.Discover(); err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, state, err := auth.Login().OIDC(provider).AuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.authorize(authURL)
+
+	if _, err = auth.Login().OIDC(provider).Exchange("unknown-state", "fake-code"); err == nil {
+		t.Fatal("unknown state should be rejected")
+	}
+	consumer, err := auth.Login().OIDC(provider).Exchange(state, "fake-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumer.GetUsername() != "admin@example.com" || !auth.IsLogin(consumer) {
+		t.Fatal("unexpected consumer", consumer.GetUsername())
+	}
+
+	// state 只能使用一次
+	if _, err = auth.Login().OIDC(provider).Exchange(state, "fake-code"); err == nil {
+		t.Fatal("state should be consumed")
+	}
+
+	// nonce 不一致的ID令牌将被拒绝
+	authURL, state, err = auth.Login().OIDC(provider).AuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.authorize(authURL)
+	fake.nonce = "other-nonce"
+	if _, err = auth.Login().OIDC(provider).Exchange(state, "fake-code"); !errors.Is(err, ErrInvalidToken) || errors.Unwrap(err).Error() != "id token nonce mismatch" {
+		t.Fatal("id token with mismatched nonce should be rejected, got", err)
+	}
+
+	// JWKS中发布的对称密钥不可用于校验ID令牌
+	authURL, state, err = auth.Login().OIDC(provider).AuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.authorize(authURL)
+	fake.symmetric = true
+	if _, err = auth.Login().OIDC(provider).Exchange(state, "fake-code"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatal("id token signed with a symmetric key should be rejected, got", err)
+	}
+}
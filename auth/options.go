@@ -0,0 +1,34 @@
+package auth
+
+import "time"
+
+// Option 认证器创建时的可选配置
+type Option func(auth *auth) error
+
+// WithJWT 使用JWT格式令牌替代默认的RSA加密标记令牌
+//
+// JWT令牌中携带 sub（用户名）、sid（消费者完整标记）、iat、exp、jti 及角色信息，可通过 Auth.ParseToken 或 JWTVerifier 离线校验
+func WithJWT(options JWTOptions) Option {
+	return func(auth *auth) error {
+		auth.jwtOptions = &options
+		return nil
+	}
+}
+
+// WithKeyProvider 使用特定的密钥提供者，默认每次创建认证器时生成一个新的 2048 位 RSA 密钥
+//
+// 多副本部署时应使用持久化的密钥（如 NewPEMFileKeyProvider），否则各副本签发的令牌将无法互相识别
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(auth *auth) error {
+		auth.keyProvider = provider
+		return nil
+	}
+}
+
+// WithKeyGracePeriod 设置密钥轮换后旧密钥的宽限期，宽限期内旧密钥签发的令牌仍然有效，默认24小时
+func WithKeyGracePeriod(grace time.Duration) Option {
+	return func(auth *auth) error {
+		auth.keyGracePeriod = grace
+		return nil
+	}
+}
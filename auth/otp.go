@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	otpDigits     = 6                // 一次性密码位数
+	totpPeriod    = 30 * time.Second // TOTP时间步长
+	totpSkew      = 1                // TOTP校验时允许前后偏移的时间步数量
+	totpSecretLen = 20               // TOTP密钥长度（字节）
+)
+
+// 不带填充的base32编码，兼容主流身份验证器应用
+var otpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成一个新的base32编码TOTP密钥
+func GenerateTOTPSecret() (string, error) {
+	var b = make([]byte, totpSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return otpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI 生成可供身份验证器应用扫码绑定的 otpauth:// URI
+func TOTPURI(issuer string, account string, secret string) string {
+	var query = url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(otpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// GenerateRecoveryCodes 生成 n 个一次性恢复码，格式为 xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	var codes = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var b = make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// HOTP 根据 RFC 4226 计算基于计数器的一次性密码
+func HOTP(secret string, counter uint64) (string, error) {
+	key, err := otpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, counter), nil
+}
+
+// TOTP 根据 RFC 6238 计算特定时间的一次性密码
+func TOTP(secret string, t time.Time) (string, error) {
+	return HOTP(secret, uint64(t.Unix()/int64(totpPeriod.Seconds())))
+}
+
+// 校验TOTP一次性密码，返回匹配的时间步
+func validateTOTP(secret string, code string, t time.Time) (step int64, ok bool) {
+	key, err := otpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return 0, false
+	}
+	current := t.Unix() / int64(totpPeriod.Seconds())
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step = current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func hotp(key []byte, counter uint64) string {
+	var msg = make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	var mod uint32 = 1
+	for i := 0; i < otpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", otpDigits, value%mod)
+}
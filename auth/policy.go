@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy 声明式的角色策略，可通过 YAML 或 JSON 文件描述
+type Policy struct {
+	Roles    []PolicyRole        `yaml:"roles" json:"roles"`       // 所有角色
+	Bindings map[string][]string `yaml:"bindings" json:"bindings"` // 用户名与角色名称的绑定，用户名为 * 时绑定到所有用户
+}
+
+// PolicyRole 策略中的角色
+type PolicyRole struct {
+	Name    string        `yaml:"name" json:"name"`       // 角色名称
+	Inherit []string      `yaml:"inherit" json:"inherit"` // 继承的父角色名称
+	Groups  []PolicyGroup `yaml:"groups" json:"groups"`   // 资源组
+}
+
+// PolicyGroup 策略中的资源组
+type PolicyGroup struct {
+	Name      string           `yaml:"name" json:"name"`           // 资源组名称
+	Deny      bool             `yaml:"deny" json:"deny"`           // 是否为拒绝资源组
+	Resources []PolicyResource `yaml:"resources" json:"resources"` // 资源
+}
+
+// PolicyResource 策略中的资源
+type PolicyResource struct {
+	Name string `yaml:"name" json:"name"` // 资源名称，为空时使用uri
+	Uri  string `yaml:"uri" json:"uri"`   // 资源uri，支持通配符
+	Deny bool   `yaml:"deny" json:"deny"` // 是否为拒绝资源
+}
+
+// LoadPolicyFile 从文件中载入策略，扩展名为 .json 时按 JSON 解析，否则按 YAML 解析
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(Policy)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, policy)
+	} else {
+		err = yaml.Unmarshal(data, policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return policy, nil
+}
+
+// Merge 合并其他策略，角色名称重复时返回错误
+func (slf *Policy) Merge(policies ...*Policy) error {
+	exist := map[string]bool{}
+	for _, r := range slf.Roles {
+		exist[r.Name] = true
+	}
+	for _, policy := range policies {
+		for _, r := range policy.Roles {
+			if exist[r.Name] {
+				return fmt.Errorf("duplicate role %q", r.Name)
+			}
+			exist[r.Name] = true
+			slf.Roles = append(slf.Roles, r)
+		}
+		for username, roles := range policy.Bindings {
+			if slf.Bindings == nil {
+				slf.Bindings = map[string][]string{}
+			}
+			slf.Bindings[username] = append(slf.Bindings[username], roles...)
+		}
+	}
+	return nil
+}
+
+// Build 校验策略并构建所有角色，返回角色名称与角色的映射
+func (slf *Policy) Build() (map[string]Role, error) {
+	helper := &RoleHelper{}
+	roles := map[string]Role{}
+	for _, info := range slf.Roles {
+		if info.Name == "" {
+			return nil, fmt.Errorf("role name is empty")
+		}
+		if _, exist := roles[info.Name]; exist {
+			return nil, fmt.Errorf("duplicate role %q", info.Name)
+		}
+		r := helper.NewRole(info.Name)
+		for _, groupInfo := range info.Groups {
+			var group ResourceGroup
+			if groupInfo.Deny {
+				group = helper.NewDenyResourceGroup(groupInfo.Name)
+			} else {
+				group = helper.NewResourceGroup(groupInfo.Name)
+			}
+			for _, resourceInfo := range groupInfo.Resources {
+				if resourceInfo.Uri == "" {
+					return nil, fmt.Errorf("role %q group %q: resource uri is empty", info.Name, groupInfo.Name)
+				}
+				name := resourceInfo.Name
+				if name == "" {
+					name = resourceInfo.Uri
+				}
+				if resourceInfo.Deny {
+					group.Add(helper.NewDenyResource(name, resourceInfo.Uri))
+				} else {
+					group.Add(helper.NewResource(name, resourceInfo.Uri))
+				}
+			}
+			r.AddResourceGroup(group)
+		}
+		roles[info.Name] = r
+	}
+	for _, info := range slf.Roles {
+		for _, parent := range info.Inherit {
+			p, exist := roles[parent]
+			if !exist {
+				return nil, fmt.Errorf("role %q inherits unknown role %q", info.Name, parent)
+			}
+			if err := roles[info.Name].Inherit(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for username, names := range slf.Bindings {
+		for _, name := range names {
+			if _, exist := roles[name]; !exist {
+				return nil, fmt.Errorf("user %q is bound to unknown role %q", username, name)
+			}
+		}
+	}
+	return roles, nil
+}
+
+// PolicyLoader 策略文件载入器，根据策略文件为消费者设置角色，支持文件变更后热重载
+type PolicyLoader struct {
+	auth     Auth
+	paths    []string
+	lock     sync.RWMutex
+	roles    map[string]Role      // 角色名称:角色
+	bindings map[string][]string  // 用户名:角色名称
+	modTimes map[string]time.Time // 文件路径:载入时的修改时间
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPolicyLoader 从多个策略文件中载入并合并策略，校验通过后将其设置为认证器的角色设置函数
+//
+// 设置角色设置函数将会退出所有已登录的账号，参考 Auth.SetRoleCheck
+func NewPolicyLoader(auth Auth, paths ...string) (*PolicyLoader, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("policy file is not specified")
+	}
+	loader := &PolicyLoader{
+		auth:  auth,
+		paths: paths,
+		stop:  make(chan struct{}),
+	}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+	auth.SetRoleCheckContext(loader.RoleSetter)
+	return loader, nil
+}
+
+// RoleSetter 根据当前策略获取用户绑定的角色，可直接作为 Auth.SetRoleCheckContext 的参数
+func (slf *PolicyLoader) RoleSetter(ctx context.Context, username string, roleHelper *RoleHelper) ([]Role, error) {
+	slf.lock.RLock()
+	defer slf.lock.RUnlock()
+	var roles []Role
+	var added = map[string]bool{}
+	for _, key := range []string{"*", username} {
+		for _, name := range slf.bindings[key] {
+			if !added[name] {
+				added[name] = true
+				roles = append(roles, slf.roles[name])
+			}
+		}
+	}
+	return roles, nil
+}
+
+// Reload 重新载入策略文件并刷新所有已登录消费者的角色，载入或校验失败时保留原有策略
+func (slf *PolicyLoader) Reload() error {
+	if err := slf.load(); err != nil {
+		return err
+	}
+	var err error
+	for _, c := range slf.auth.GetAllConsumer() {
+		if e := slf.auth.RefreshRole(c); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Watch 每隔 interval 检查一次策略文件的修改时间，发生变更时自动重载，直到调用 Close
+func (slf *PolicyLoader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-slf.stop:
+				return
+			case <-ticker.C:
+				if !slf.changed() {
+					continue
+				}
+				if err := slf.Reload(); err != nil {
+					slf.auth.getLogger().Error("reload policy failed", "paths", strings.Join(slf.paths, ","), logKeyError, err)
+				}
+			}
+		}
+	}()
+}
+
+// Close 停止监听策略文件
+func (slf *PolicyLoader) Close() {
+	slf.stopOnce.Do(func() {
+		close(slf.stop)
+	})
+}
+
+// 载入并校验所有策略文件
+func (slf *PolicyLoader) load() error {
+	modTimes := map[string]time.Time{}
+	policy := new(Policy)
+	for _, path := range slf.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+		p, err := LoadPolicyFile(path)
+		if err != nil {
+			return err
+		}
+		if err = policy.Merge(p); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	roles, err := policy.Build()
+	if err != nil {
+		return err
+	}
+	slf.lock.Lock()
+	slf.roles = roles
+	slf.bindings = policy.Bindings
+	slf.modTimes = modTimes
+	slf.lock.Unlock()
+	return nil
+}
+
+// 检查策略文件自载入后是否发生变更
+func (slf *PolicyLoader) changed() bool {
+	slf.lock.RLock()
+	defer slf.lock.RUnlock()
+	for _, path := range slf.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(slf.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"github.com/kercylan98/go-session/session"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+roles:
+  - name: user
+    groups:
+      - name: user
+        resources:
+          - name: get user
+            uri: get:/api/user/{id}
+  - name: admin
+    inherit: [user]
+    groups:
+      - name: all
+        resources:
+          - uri: "**"
+      - name: billing
+        deny: true
+        resources:
+          - uri: "*:/api/billing/**"
+bindings:
+  "*": [user]
+  admin: [admin]
+`
+
+func TestPolicyLoader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader, err := NewPolicyLoader(a, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+
+	a.AddTempAccount("admin", "12345")
+	a.AddTempAccount("guest", "12345")
+	admin, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := a.Login().Password("guest", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !admin.ResourceExist("get:/api/project", "get:/api/user/1") || admin.ResourceExist("get:/api/billing") {
+		t.Fatal("admin resources mismatch")
+	}
+	if !guest.ResourceExist("get:/api/user/1") || guest.ResourceExist("get:/api/project") {
+		t.Fatal("guest resources mismatch")
+	}
+
+	// 校验失败时保留原有策略
+	if err = os.WriteFile(path, []byte(strings.Replace(testPolicy, "inherit: [user]", "inherit: [root]", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = loader.Reload(); err == nil || !strings.Contains(err.Error(), "unknown role") {
+		t.Fatal("expect unknown role error, got", err)
+	}
+	if c, _ := a.GetConsumer(guest.GetTag()); !c.ResourceExist("get:/api/user/1") {
+		t.Fatal("policy should be kept after a failed reload")
+	}
+
+	// 文件变更后自动重载并刷新已登录的消费者
+	if err = os.WriteFile(path, []byte(strings.Replace(testPolicy, `"*": [user]`, `"*": []`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	loader.Watch(10 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c, err := a.GetConsumer(guest.GetTag())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.ResourceExist("get:/api/user/1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("policy was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c, _ := a.GetConsumer(admin.GetTag()); !c.ResourceExist("get:/api/user/1") {
+		t.Fatal("admin should keep inherited resources")
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"roles": [{"name": "a", "inherit": ["b"]}, {"name": "b", "inherit": ["a"]}]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = policy.Build(); err == nil || !strings.Contains(err.Error(), ErrRoleCycle.Error()) {
+		t.Fatal("expect role cycle, got", err)
+	}
+}
@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/kercylan98/go-session/session"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAccessExpire  = 15 * time.Minute
+	defaultRefreshExpire = 7 * 24 * time.Hour
+
+	refreshFamilyPrefix = "__x_x__refresh_family:" // 刷新令牌族会话id前缀
+	refreshFamilyIdSize = 32                       // 刷新令牌族id长度（16字节随机数的十六进制）
+	refreshSecretSize   = 32                       // 刷新令牌密文长度
+	refreshGenSize      = 8                        // 刷新令牌代数长度（大端序 uint64）
+
+	sessionKeyToken         = "token"          // 消费者会话中的访问令牌
+	sessionKeyTokenExpire   = "token_expire"   // 消费者会话中的访问令牌过期时间
+	sessionKeyRefreshToken  = "refresh_token"  // 消费者会话中的刷新令牌
+	sessionKeyRefreshFamily = "refresh_family" // 消费者会话中的刷新令牌族id
+
+	familyKeyTag     = "tag"     // 刷新令牌族所属的消费者标记
+	familyKeyCurrent = "current" // 当前可用刷新令牌的代数及摘要，格式为 代数:摘要
+	familyKeyExpire  = "expire"  // 刷新令牌族过期时间
+)
+
+// RefreshOptions 访问令牌及刷新令牌配置
+type RefreshOptions struct {
+	AccessExpire  time.Duration // 访问令牌有效期，默认15分钟
+	RefreshExpire time.Duration // 刷新令牌有效期（自登录起计算，轮换不会延长），默认7天
+}
+
+// WithRefreshToken 启用访问令牌及刷新令牌
+//
+// 登录后消费者将同时持有短期的访问令牌（Consumer.GetToken）及长期的刷新令牌（Consumer.GetRefreshToken），
+// 通过 Auth.Refresh 使用刷新令牌轮换两者。每次轮换令牌族的代数加一，当已轮换的（代数低于当前代数的）刷新令牌再次出现时，
+// 无论已轮换多少次，都将吊销该消费者的整个令牌族并使其下线。
+// 刷新令牌的有效期不应超过会话管理器的过期时间
+func WithRefreshToken(options RefreshOptions) Option {
+	return func(auth *auth) error {
+		if options.AccessExpire <= 0 {
+			options.AccessExpire = defaultAccessExpire
+		}
+		if options.RefreshExpire <= 0 {
+			options.RefreshExpire = defaultRefreshExpire
+		}
+		auth.refreshOptions = &options
+		return nil
+	}
+}
+
+func (slf *auth) Refresh(refreshToken string) (Consumer, error) {
+	if slf.refreshOptions == nil {
+		return nil, newError(ErrNotEnabled, "refresh token is not enabled")
+	}
+	familyId, generation, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一令牌族的轮换需串行执行，不同令牌族之间互不阻塞
+	unlock := slf.familyLocks.Lock(familyId)
+	defer unlock()
+
+	family, err := slf.sm.GetSession(refreshFamilyPrefix + familyId)
+	if err != nil {
+		return nil, wrapError(ErrInvalidToken, sessionError(err))
+	}
+	tag, err := loadString(family, familyKeyTag)
+	if err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	expire, err := loadString(family, familyKeyExpire)
+	if err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	if expireAt, _ := strconv.ParseInt(expire, 10, 64); time.Now().Unix() >= expireAt {
+		_ = slf.sm.UnRegisterSession(family)
+		return nil, ErrTokenExpired
+	}
+
+	current, err := loadString(family, familyKeyCurrent)
+	if err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	currentGeneration, currentDigest := parseFamilyCurrent(current)
+	if generation < currentGeneration {
+		// 已轮换的刷新令牌被再次使用，视为泄露，吊销整个令牌族
+		_ = slf.sm.UnRegisterSession(family)
+		if c, err := slf.GetConsumer(tag); err == nil {
+			_ = slf.Ban(c)
+		}
+		return nil, newError(ErrInvalidToken, "refresh token reused, token family has been revoked")
+	}
+	if generation > currentGeneration || refreshDigest(secret) != currentDigest {
+		return nil, newError(ErrInvalidToken, "invalid refresh token")
+	}
+
+	consumer, err := slf.GetConsumer(tag)
+	if err != nil {
+		_ = slf.sm.UnRegisterSession(family)
+		return nil, err
+	}
+	ses, err := slf.getSession(consumer)
+	if err != nil {
+		return nil, err
+	}
+	if err = slf.RefreshRole(consumer); err != nil {
+		return nil, err
+	}
+	event := newEvent(Event{Type: EventTokenRefreshed, Consumer: consumer})
+	if err = slf.emit(context.Background(), event); err != nil {
+		return nil, err
+	}
+	if err = slf.issueToken(consumer, ses); err != nil {
+		return nil, err
+	}
+
+	// 轮换刷新令牌，代数与摘要一并写入，避免两者不一致
+	newSecret, err := newRefreshSecret()
+	if err != nil {
+		return nil, err
+	}
+	generation++
+	if err = family.Store(familyKeyCurrent, formatFamilyCurrent(generation, refreshDigest(newSecret))); err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	if err = ses.Store(sessionKeyRefreshToken, encodeRefreshToken(familyId, generation, newSecret)); err != nil {
+		return nil, wrapError(ErrStore, err)
+	}
+	slf.publish(event)
+	return consumer, nil
+}
+
+// 为消费者签发新的访问令牌并存储至会话
+func (slf *auth) issueToken(consumer Consumer, ses session.Session) error {
+	token, err := slf.tokenizer.issue(consumer)
+	if err != nil {
+		return err
+	}
+	if err = ses.Store(sessionKeyToken, token); err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if slf.refreshOptions != nil {
+		expire := time.Now().Add(slf.refreshOptions.AccessExpire).Unix()
+		if err = ses.Store(sessionKeyTokenExpire, strconv.FormatInt(expire, 10)); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+	return nil
+}
+
+// 为消费者创建新的刷新令牌族，原有令牌族将被吊销
+func (slf *auth) newRefreshFamily(consumer Consumer, ses session.Session) error {
+	if old, err := loadString(ses, sessionKeyRefreshFamily); err == nil {
+		slf.revokeRefreshFamily(old)
+	}
+
+	var b = make([]byte, refreshFamilyIdSize/2)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	familyId := hex.EncodeToString(b)
+	secret, err := newRefreshSecret()
+	if err != nil {
+		return err
+	}
+
+	family, err := slf.sm.RegisterSession(refreshFamilyPrefix + familyId)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	expire := time.Now().Add(slf.refreshOptions.RefreshExpire).Unix()
+	for key, value := range map[string]string{
+		familyKeyTag:     consumer.GetTag(),
+		familyKeyCurrent: formatFamilyCurrent(1, refreshDigest(secret)),
+		familyKeyExpire:  strconv.FormatInt(expire, 10),
+	} {
+		if err = family.Store(key, value); err != nil {
+			return wrapError(ErrStore, err)
+		}
+	}
+
+	if err = ses.Store(sessionKeyRefreshFamily, familyId); err != nil {
+		return wrapError(ErrStore, err)
+	}
+	return wrapError(ErrStore, ses.Store(sessionKeyRefreshToken, encodeRefreshToken(familyId, 1, secret)))
+}
+
+// 吊销刷新令牌族
+func (slf *auth) revokeRefreshFamily(familyId string) {
+	if family, err := slf.sm.GetSession(refreshFamilyPrefix + familyId); err == nil {
+		_ = slf.sm.UnRegisterSession(family)
+	}
+}
+
+// 检查访问令牌是否为消费者当前持有且未过期
+func (slf *auth) checkAccessToken(consumer Consumer, token string) error {
+	ses, err := slf.getSession(consumer)
+	if err != nil {
+		return err
+	}
+	current, err := loadString(ses, sessionKeyToken)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if current != token {
+		return newError(ErrInvalidToken, "token has been replaced")
+	}
+	expire, err := loadString(ses, sessionKeyTokenExpire)
+	if err != nil {
+		return wrapError(ErrStore, err)
+	}
+	if expireAt, _ := strconv.ParseInt(expire, 10, 64); time.Now().Unix() >= expireAt {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// 编码刷新令牌，v2：令牌族id(32字节) + 令牌代数(8字节) + 令牌密文(32字节)
+func encodeRefreshToken(familyId string, generation uint64, secret string) string {
+	payload := make([]byte, 0, refreshFamilyIdSize+refreshGenSize+refreshSecretSize)
+	payload = append(payload, familyId...)
+	payload = binary.BigEndian.AppendUint64(payload, generation)
+	payload = append(payload, secret...)
+	return encodeToken(tokenVersion2, payload)
+}
+
+// 解析刷新令牌，返回令牌族id、令牌代数及令牌密文，格式错误时返回 ErrInvalidToken
+//
+// v1 格式（令牌族id + 令牌密文）的刷新令牌视为第0代
+func parseRefreshToken(refreshToken string) (familyId string, generation uint64, secret string, err error) {
+	version, payload, err := decodeToken(refreshToken)
+	if err != nil {
+		return "", 0, "", wrapError(ErrInvalidToken, err)
+	}
+	switch version {
+	case tokenVersion1:
+		if len(payload) != refreshFamilyIdSize+refreshSecretSize {
+			return "", 0, "", newError(ErrInvalidToken, "malformed refresh token")
+		}
+		return string(payload[:refreshFamilyIdSize]), 0, string(payload[refreshFamilyIdSize:]), nil
+	case tokenVersion2:
+		if len(payload) != refreshFamilyIdSize+refreshGenSize+refreshSecretSize {
+			return "", 0, "", newError(ErrInvalidToken, "malformed refresh token")
+		}
+		generation = binary.BigEndian.Uint64(payload[refreshFamilyIdSize : refreshFamilyIdSize+refreshGenSize])
+		return string(payload[:refreshFamilyIdSize]), generation, string(payload[refreshFamilyIdSize+refreshGenSize:]), nil
+	default:
+		return "", 0, "", newError(ErrInvalidToken, "unsupported refresh token version")
+	}
+}
+
+// 格式化令牌族当前可用刷新令牌的代数及摘要
+func formatFamilyCurrent(generation uint64, digest string) string {
+	return strconv.FormatUint(generation, 10) + ":" + digest
+}
+
+// 解析令牌族当前可用刷新令牌的代数及摘要，仅包含摘要的旧格式视为第0代
+func parseFamilyCurrent(value string) (generation uint64, digest string) {
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		generation, _ = strconv.ParseUint(value[:i], 10, 64)
+		return generation, value[i+1:]
+	}
+	return 0, value
+}
+
+// 生成刷新令牌密文
+func newRefreshSecret() (string, error) {
+	var b = make([]byte, refreshSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// 刷新令牌摘要，令牌族中仅存储摘要
+func refreshDigest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// 从会话中加载字符串
+func loadString(ses session.Session, key string) (string, error) {
+	value, err := ses.Load(key)
+	if err != nil {
+		return "", err
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", errors.New("unexpected session value type with key: " + key)
+	}
+	return str, nil
+}
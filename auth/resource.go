@@ -6,18 +6,22 @@ type Resource interface {
 	GetName() string
 	// GetURI 获取资源URI
 	GetURI() string
+	// IsDeny 是否为拒绝资源
+	IsDeny() bool
 }
 
-func newResource(name string, uri string) *resource {
+func newResource(name string, uri string, deny bool) *resource {
 	return &resource{
 		Name: name,
 		Uri:  uri,
+		Deny: deny,
 	}
 }
 
 type resource struct {
 	Name string // 资源名称
 	Uri  string // Uri
+	Deny bool   // 是否为拒绝资源
 }
 
 func (slf *resource) GetName() string {
@@ -27,3 +31,7 @@ func (slf *resource) GetName() string {
 func (slf *resource) GetURI() string {
 	return slf.Uri
 }
+
+func (slf *resource) IsDeny() bool {
+	return slf.Deny
+}
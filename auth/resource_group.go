@@ -1,5 +1,7 @@
 package auth
 
+import "sync"
+
 // ResourceGroup 资源组
 type ResourceGroup interface {
 	// GetName 获取资源组名称
@@ -10,17 +12,24 @@ type ResourceGroup interface {
 	GetAllResource() []Resource
 	// Add 添加资源
 	Add(resource ...Resource) ResourceGroup
-	// Exist 资源是否存在
+	// Exist 资源组是否授予该资源，即命中允许资源且未命中拒绝资源
+	//
+	// 资源的uri可以是包含通配符的模式，如 get:/api/user/** 、 /api/project/* 、 get:/api/user/{id}
 	Exist(resourceUri string) bool
+	// Match 获取与uri匹配的最具体的资源，完全相同的资源优先
+	Match(resourceUri string) (Resource, bool)
 	// GetResource 通过uri获取资源
 	GetResource(uri string) Resource
+	// IsDeny 是否为拒绝资源组
+	IsDeny() bool
 }
 
-func newResourceGroup(name string) *resourceGroup {
+func newResourceGroup(name string, deny bool) *resourceGroup {
 	return &resourceGroup{
 		Name:      name,
 		Resources: []Resource{},
 		Mapper:    map[string]int{},
+		Deny:      deny,
 	}
 }
 
@@ -28,6 +37,12 @@ type resourceGroup struct {
 	Name      string         // 资源组名称
 	Resources []Resource     // 所有资源
 	Mapper    map[string]int // 资源映射判定是否重复 (Uri:index)
+	Deny      bool           // 是否为拒绝资源组，组内所有资源均视为拒绝资源
+
+	matcher     *resourceMatcher // 通配资源匹配器，延迟构建，添加资源后重建
+	allow       *resourceMatcher // 允许资源匹配器
+	deny        *resourceMatcher // 拒绝资源匹配器
+	matcherLock sync.Mutex
 }
 
 func (slf *resourceGroup) GetResource(uri string) Resource {
@@ -46,18 +61,82 @@ func (slf *resourceGroup) GetAllResource() []Resource {
 	return slf.Resources
 }
 
+func (slf *resourceGroup) IsDeny() bool {
+	return slf.Deny
+}
+
 func (slf *resourceGroup) Exist(resourceUri string) bool {
-	_, exist := slf.Mapper[resourceUri]
-	return exist
+	allow, deny := slf.decide(resourceUri)
+	return allow != nil && deny == nil
+}
+
+func (slf *resourceGroup) Match(resourceUri string) (Resource, bool) {
+	if index, exist := slf.Mapper[resourceUri]; exist {
+		return slf.Resources[index], true
+	}
+	matcher, _, _ := slf.getMatcher()
+	if index, exist := matcher.match(resourceUri); exist {
+		return slf.Resources[index], true
+	}
+	return nil, false
+}
+
+// 获取与uri匹配的允许资源及拒绝资源，未匹配时为nil
+func (slf *resourceGroup) decide(resourceUri string) (allow Resource, deny Resource) {
+	_, allowMatcher, denyMatcher := slf.getMatcher()
+	if index, exist := slf.Mapper[resourceUri]; exist {
+		if r := slf.Resources[index]; slf.isDeny(r) {
+			deny = r
+		} else {
+			allow = r
+		}
+	}
+	if deny == nil {
+		if index, exist := denyMatcher.match(resourceUri); exist {
+			deny = slf.Resources[index]
+		}
+	}
+	if allow == nil && deny == nil {
+		if index, exist := allowMatcher.match(resourceUri); exist {
+			allow = slf.Resources[index]
+		}
+	}
+	return
+}
+
+// 资源在该组中是否为拒绝资源
+func (slf *resourceGroup) isDeny(r Resource) bool {
+	return slf.Deny || r.IsDeny()
 }
 
 func (slf *resourceGroup) Add(resource ...Resource) ResourceGroup {
 	for _, r := range resource {
-		if slf.Exist(r.GetURI()) {
+		if _, exist := slf.Mapper[r.GetURI()]; exist {
 			continue
 		}
 		slf.Mapper[r.GetURI()] = len(slf.Resources)
 		slf.Resources = append(slf.Resources, r)
 	}
+	slf.matcherLock.Lock()
+	slf.matcher, slf.allow, slf.deny = nil, nil, nil
+	slf.matcherLock.Unlock()
 	return slf
 }
+
+// 获取所有资源、允许资源及拒绝资源的通配匹配器，不存在时根据所有资源构建
+func (slf *resourceGroup) getMatcher() (matcher, allow, deny *resourceMatcher) {
+	slf.matcherLock.Lock()
+	defer slf.matcherLock.Unlock()
+	if slf.matcher == nil {
+		slf.matcher, slf.allow, slf.deny = newResourceMatcher(), newResourceMatcher(), newResourceMatcher()
+		for i, r := range slf.Resources {
+			slf.matcher.add(r.GetURI(), i)
+			if slf.isDeny(r) {
+				slf.deny.add(r.GetURI(), i)
+			} else {
+				slf.allow.add(r.GetURI(), i)
+			}
+		}
+	}
+	return slf.matcher, slf.allow, slf.deny
+}
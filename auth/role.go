@@ -4,42 +4,46 @@ package auth
 type Role interface {
 	// GetName 获取角色名称
 	GetName() string
-	// GetAllResourceGroup 获取所有资源组
+	// GetAllResourceGroup 获取角色自身的所有资源组，不包含继承的资源组
 	GetAllResourceGroup() []ResourceGroup
-	// GetAllResource 获取所有资源
+	// GetAllResource 获取所有资源，包含继承自父角色的资源
 	GetAllResource() []Resource
-	// Exist 角色是否同时拥有多条资源
+	// Exist 角色是否同时拥有多条资源，包含继承自父角色的资源，任意资源组命中拒绝资源时视为不拥有
 	Exist(resourceUri ...string) bool
 	// AddResourceGroup 添加资源组
 	AddResourceGroup(resourceGroup ...ResourceGroup) Role
+	// Inherit 继承父角色的所有资源，父角色的拒绝资源同样生效
+	//
+	// 角色以名称区分，继承关系形成环时返回 ErrRoleCycle 且不会继承任何父角色
+	Inherit(parents ...Role) error
+	// GetParents 获取直接继承的父角色
+	GetParents() []Role
 }
 
 func newRole(name string) *role {
 	return &role{
 		Name:           name,
 		ResourceGroups: []ResourceGroup{},
+		Parents:        []Role{},
 	}
 }
 
 type role struct {
 	Name           string          // 角色名称
 	ResourceGroups []ResourceGroup // 角色拥有对资源组
+	Parents        []Role          // 继承的父角色
 }
 
 func (slf *role) Exist(resourceUri ...string) bool {
-	var count = 0
-	var match = len(resourceUri)
-	for _, group := range slf.ResourceGroups {
-		for _, s := range resourceUri {
-			if group.Exist(s) {
-				count++
-				if count == match {
-					return true
-				}
-			}
+	if len(resourceUri) == 0 {
+		return false
+	}
+	for _, s := range resourceUri {
+		if !decide([]Role{slf}, s).Allowed {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 func (slf *role) GetName() string {
@@ -52,8 +56,10 @@ func (slf *role) GetAllResourceGroup() []ResourceGroup {
 
 func (slf *role) GetAllResource() []Resource {
 	var resources []Resource
-	for _, group := range slf.ResourceGroups {
-		resources = append(resources, group.GetAllResource()...)
+	for _, r := range lineage([]Role{slf}) {
+		for _, group := range r.GetAllResourceGroup() {
+			resources = append(resources, group.GetAllResource()...)
+		}
 	}
 	return resources
 }
@@ -62,3 +68,19 @@ func (slf *role) AddResourceGroup(resourceGroup ...ResourceGroup) Role {
 	slf.ResourceGroups = append(slf.ResourceGroups, resourceGroup...)
 	return slf
 }
+
+func (slf *role) Inherit(parents ...Role) error {
+	for _, parent := range parents {
+		for _, r := range lineage([]Role{parent}) {
+			if r.GetName() == slf.Name {
+				return newError(ErrRoleCycle, "role "+slf.Name+" cannot inherit from "+parent.GetName())
+			}
+		}
+	}
+	slf.Parents = append(slf.Parents, parents...)
+	return nil
+}
+
+func (slf *role) GetParents() []Role {
+	return slf.Parents
+}
@@ -14,12 +14,26 @@ func (slf *RoleHelper) NewRole(name string) Role {
 //
 // 资源组可以对多条资源权限进行管理、分类
 func (slf *RoleHelper) NewResourceGroup(name string) ResourceGroup {
-	return newResourceGroup(name)
+	return newResourceGroup(name, false)
+}
+
+// NewDenyResourceGroup 创建一个拒绝资源组
+//
+// 资源组中的所有资源均视为拒绝资源
+func (slf *RoleHelper) NewDenyResourceGroup(name string) ResourceGroup {
+	return newResourceGroup(name, true)
 }
 
 // NewResource 创建一条资源权限
 //
 // 拥有该条资源就表示拥有该权限
 func (slf *RoleHelper) NewResource(name string, uri string) Resource {
-	return newResource(name, uri)
+	return newResource(name, uri, false)
+}
+
+// NewDenyResource 创建一条拒绝资源
+//
+// 任意角色命中拒绝资源时，即便其他角色拥有该权限也将被拒绝
+func (slf *RoleHelper) NewDenyResource(name string, uri string) Resource {
+	return newResource(name, uri, true)
 }
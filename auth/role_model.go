@@ -1,15 +1,20 @@
 package auth
 
-type roleModel []struct {
+type roleModel []roleInfo
+
+type roleInfo struct {
 	Name           string `json:"Name"`
 	ResourceGroups []struct {
 		Mapper    map[string]int `json:"Mapper"`
 		Name      string         `json:"Name"`
+		Deny      bool           `json:"Deny"`
 		Resources []struct {
 			Name string `json:"Name"`
 			URI  string `json:"Uri"`
+			Deny bool   `json:"Deny"`
 		} `json:"Resources"`
 	} `json:"ResourceGroups"`
+	Parents roleModel `json:"Parents"`
 }
 
 func (slf *roleModel) toRoles() []Role {
@@ -18,18 +23,21 @@ func (slf *roleModel) toRoles() []Role {
 		role := new(role)
 		role.Name = roleInfo.Name
 		role.ResourceGroups = []ResourceGroup{}
+		role.Parents = roleInfo.Parents.toRoles()
 		for _, resourceGroupInfo := range roleInfo.ResourceGroups {
 			var resources []Resource
 			for _, resourceInfo := range resourceGroupInfo.Resources {
 				resources = append(resources, &resource{
 					Name: resourceInfo.Name,
 					Uri:  resourceInfo.URI,
+					Deny: resourceInfo.Deny,
 				})
 			}
 			role.ResourceGroups = append(role.ResourceGroups, &resourceGroup{
 				Name:      resourceGroupInfo.Name,
 				Resources: resources,
 				Mapper:    resourceGroupInfo.Mapper,
+				Deny:      resourceGroupInfo.Deny,
 			})
 		}
 		roles = append(roles, role)
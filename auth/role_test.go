@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRole_Inherit(t *testing.T) {
+	helper := &RoleHelper{}
+	user := helper.NewRole("user").
+		AddResourceGroup(helper.NewResourceGroup("user").
+			Add(helper.NewResource("get", "get:/api/user")))
+	admin := helper.NewRole("admin").
+		AddResourceGroup(helper.NewResourceGroup("project").
+			Add(helper.NewResource("get", "/api/project/get")).
+			Add(helper.NewDenyResource("billing", "/api/billing/**")))
+	administrator := helper.NewRole("administrator")
+
+	if err := admin.Inherit(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := administrator.Inherit(admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.Inherit(administrator); !errors.Is(err, ErrRoleCycle) {
+		t.Fatal("expect role cycle, got", err)
+	}
+	if err := user.Inherit(user); !errors.Is(err, ErrRoleCycle) || len(user.GetParents()) != 0 {
+		t.Fatal("expect role cycle, got", err)
+	}
+
+	if !administrator.Exist("get:/api/user", "/api/project/get") || administrator.Exist("/api/billing/invoice") {
+		t.Fatal("inherited resources mismatch")
+	}
+	if n := len(administrator.GetAllResource()); n != 3 {
+		t.Fatal("expect 3 resources, got", n)
+	}
+
+	c := newConsumer(nil, "admin", "")
+	c.setRole(administrator)
+	if !c.RoleExist("administrator", "user") || c.RoleExist("guest") {
+		t.Fatal("role exist mismatch")
+	}
+	if decision := c.Decide("get:/api/user"); decision.Role != "user" || decision.Group != "user" {
+		t.Fatal("decision should be made by parent role", decision)
+	}
+
+	// 经过会话管理器的序列化后依旧保留继承关系
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := new(auth).jsonToConsumer(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.ResourceExist("get:/api/user", "/api/project/get") || restored.ResourceExist("/api/billing/invoice") || !restored.RoleExist("user") {
+		t.Fatal("restored consumer lost role hierarchy")
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"github.com/kercylan98/go-session/session"
+	"sync"
+	"time"
+)
+
+// 为会话管理器及其会话加锁的包装
+//
+// 会话管理器的内存实现未对会话数据加锁，且在查询时会无锁地清理过期会话，
+// 策略热重载、会话过期检查等后台任务与请求并发访问会话时将产生数据竞争。
+// 因此管理器操作共用一把锁（Redis 实现的管理器操作本身即通过全局的 manager_lock 串行执行），
+// 会话数据的读写则按会话id加锁，不同会话之间互不阻塞
+type syncManager struct {
+	sync.Mutex            // 管理器操作锁，同时保护会话的过期时间及注销
+	sessions   keyedMutex // 会话数据锁，按会话id保护 Store、Load 及 Del
+	manager    session.Manager
+}
+
+func newSyncManager(manager session.Manager) *syncManager {
+	return &syncManager{manager: manager}
+}
+
+func (slf *syncManager) RegisterSession(id string) (session.Session, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	ses, err := slf.manager.RegisterSession(id)
+	if err != nil {
+		return nil, err
+	}
+	return &syncSession{ses: ses, manager: slf}, nil
+}
+
+func (slf *syncManager) UnRegisterSession(ses session.Session) error {
+	if s, ok := ses.(*syncSession); ok {
+		ses = s.ses
+	}
+	slf.Lock()
+	defer slf.Unlock()
+	return slf.manager.UnRegisterSession(ses)
+}
+
+func (slf *syncManager) GetAllSession() ([]session.Session, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	sessions, err := slf.manager.GetAllSession()
+	if err != nil {
+		return nil, err
+	}
+	var wrapped = make([]session.Session, len(sessions))
+	for i, ses := range sessions {
+		wrapped[i] = &syncSession{ses: ses, manager: slf}
+	}
+	return wrapped, nil
+}
+
+func (slf *syncManager) GetSession(id string) (session.Session, error) {
+	slf.Lock()
+	defer slf.Unlock()
+	ses, err := slf.manager.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	return &syncSession{ses: ses, manager: slf}, nil
+}
+
+func (slf *syncManager) SetExpire(expire time.Duration) error {
+	slf.Lock()
+	defer slf.Unlock()
+	return slf.manager.SetExpire(expire)
+}
+
+// 数据读写按会话id加锁，过期及注销操作与所属会话管理器共用同一把锁的会话
+type syncSession struct {
+	ses     session.Session
+	manager *syncManager
+}
+
+func (slf *syncSession) GetId() string {
+	return slf.ses.GetId()
+}
+
+func (slf *syncSession) Store(key string, value interface{}) error {
+	unlock := slf.manager.sessions.Lock(slf.ses.GetId())
+	defer unlock()
+	return slf.ses.Store(key, value)
+}
+
+func (slf *syncSession) Load(key string) (interface{}, error) {
+	unlock := slf.manager.sessions.Lock(slf.ses.GetId())
+	defer unlock()
+	return slf.ses.Load(key)
+}
+
+func (slf *syncSession) Del(key string) error {
+	unlock := slf.manager.sessions.Lock(slf.ses.GetId())
+	defer unlock()
+	return slf.ses.Del(key)
+}
+
+func (slf *syncSession) Close() error {
+	slf.manager.Lock()
+	defer slf.manager.Unlock()
+	return slf.ses.Close()
+}
+
+func (slf *syncSession) GetSessionManager() session.Manager {
+	return slf.manager
+}
+
+func (slf *syncSession) IsExpire() bool {
+	slf.manager.Lock()
+	defer slf.manager.Unlock()
+	return slf.ses.IsExpire()
+}
+
+func (slf *syncSession) SetExpire(expire time.Duration) error {
+	slf.manager.Lock()
+	defer slf.manager.Unlock()
+	return slf.ses.SetExpire(expire)
+}
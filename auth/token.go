@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+)
+
+const (
+	tokenVersion1 byte = 1 // 令牌格式版本1
+	tokenVersion2 byte = 2 // 令牌格式版本2，刷新令牌携带令牌代数
+)
+
+// Claims 令牌中携带的声明信息
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`   // 签发者
+	Subject   string   `json:"sub,omitempty"`   // 用户名
+	SessionID string   `json:"sid"`             // 消费者完整标记
+	IssuedAt  int64    `json:"iat,omitempty"`   // 签发时间（Unix秒）
+	ExpiresAt int64    `json:"exp,omitempty"`   // 过期时间（Unix秒）
+	ID        string   `json:"jti,omitempty"`   // 令牌唯一标识
+	Roles     []string `json:"roles,omitempty"` // 签发时消费者拥有的角色名称
+}
+
+// 令牌编解码器，负责令牌的签发及解析
+type tokenizer interface {
+	// 为消费者签发令牌
+	issue(consumer Consumer) (string, error)
+	// 解析并校验令牌，不会访问会话管理器
+	parse(token string) (*Claims, error)
+}
+
+func newRsaTokenizer(ring *keyRing) *rsaTokenizer {
+	return &rsaTokenizer{
+		ring: ring,
+	}
+}
+
+// 采用RSA加密消费者标记的令牌
+type rsaTokenizer struct {
+	ring *keyRing
+}
+
+func (slf *rsaTokenizer) issue(consumer Consumer) (string, error) {
+	key := slf.ring.current()
+	if key.PublicKey == nil {
+		return "", errors.New("rsa token requires an rsa key")
+	}
+	if len(key.ID) > 255 {
+		return "", errors.New("key id is too long")
+	}
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, key.PublicKey, []byte(consumer.GetTag()))
+	if err != nil {
+		return "", err
+	}
+	// v1：kid长度(1字节) + kid + 密文
+	payload := make([]byte, 0, 1+len(key.ID)+len(ciphertext))
+	payload = append(payload, byte(len(key.ID)))
+	payload = append(payload, key.ID...)
+	payload = append(payload, ciphertext...)
+	return encodeToken(tokenVersion1, payload), nil
+}
+
+func (slf *rsaTokenizer) parse(token string) (*Claims, error) {
+	claims, err := slf.decrypt(token)
+	if err != nil {
+		return nil, wrapError(ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// 解密令牌中的消费者标记
+func (slf *rsaTokenizer) decrypt(token string) (*Claims, error) {
+	version, payload, err := decodeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if version != tokenVersion1 {
+		return nil, errors.New("unsupported token version")
+	}
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return nil, errors.New("malformed token")
+	}
+	kid, ciphertext := string(payload[1:1+int(payload[0])]), payload[1+int(payload[0]):]
+	key, err := slf.ring.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.PrivateKey == nil {
+		return nil, errors.New("rsa token requires an rsa private key")
+	}
+	tag, err := rsa.DecryptPKCS1v15(rand.Reader, key.PrivateKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(tag) == 0 {
+		return nil, errors.New("token does not contain consumer tag")
+	}
+	return &Claims{SessionID: string(tag)}, nil
+}
+
+// 将令牌负载编码为带版本号的URL安全字符串（base64url，无填充），版本号位于首字节，便于后续调整令牌格式
+func encodeToken(version byte, payload []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append([]byte{version}, payload...))
+}
+
+// 解码带版本号的令牌，返回版本号及负载
+func decodeToken(token string) (version byte, payload []byte, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, nil, errors.New("malformed token")
+	}
+	if len(data) < 1 {
+		return 0, nil, errors.New("malformed token")
+	}
+	return data[0], data[1:], nil
+}
@@ -0,0 +1,203 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/kercylan98/go-auth/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"strings"
+)
+
+// 消费者在上下文中的键
+type consumerKey struct{}
+
+// NewContext 返回携带消费者的上下文
+func NewContext(ctx context.Context, consumer auth.Consumer) context.Context {
+	return context.WithValue(ctx, consumerKey{}, consumer)
+}
+
+// ConsumerFromContext 获取服务端拦截器写入上下文的消费者
+func ConsumerFromContext(ctx context.Context) (auth.Consumer, bool) {
+	consumer, ok := ctx.Value(consumerKey{}).(auth.Consumer)
+	return consumer, ok
+}
+
+// TokenSource 客户端获取令牌的函数
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken 始终返回同一令牌的 TokenSource
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// UnaryServerInterceptor 创建一元调用的服务端认证拦截器
+//
+// 拦截器从元数据中读取令牌并通过 Auth 获取消费者，检查消费者是否拥有方法所需的资源后写入上下文，可通过 ConsumerFromContext 获取。
+// 未携带令牌或令牌无效时返回 codes.Unauthenticated，缺少资源时返回 codes.PermissionDenied，会话管理器不可用时返回 codes.Unavailable。
+// 返回给调用方的状态仅包含与状态码对应的固定信息，具体原因通过 WithLogger 设置的日志记录器在服务端输出
+func UnaryServerInterceptor(a auth.Auth, options ...Option) grpc.UnaryServerInterceptor {
+	i := newInterceptor(a, options...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 创建流式调用的服务端认证拦截器，行为同 UnaryServerInterceptor
+func StreamServerInterceptor(a auth.Auth, options ...Option) grpc.StreamServerInterceptor {
+	i := newInterceptor(a, options...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// UnaryClientInterceptor 创建一元调用的客户端拦截器，将令牌写入元数据
+func UnaryClientInterceptor(source TokenSource, options ...Option) grpc.UnaryClientInterceptor {
+	i := newInterceptor(nil, options...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := i.attach(ctx, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor 创建流式调用的客户端拦截器，将令牌写入元数据
+func StreamClientInterceptor(source TokenSource, options ...Option) grpc.StreamClientInterceptor {
+	i := newInterceptor(nil, options...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := i.attach(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func newInterceptor(a auth.Auth, options ...Option) *interceptor {
+	i := &interceptor{
+		auth:      a,
+		key:       "authorization",
+		scheme:    "Bearer",
+		resources: map[string][]string{},
+		public:    map[string]bool{},
+		logger:    slog.Default(),
+	}
+	for _, option := range options {
+		option(i)
+	}
+	i.key = strings.ToLower(i.key)
+	return i
+}
+
+type interceptor struct {
+	auth      auth.Auth
+	key       string              // 令牌所在的元数据键
+	scheme    string              // 令牌前缀
+	resources map[string][]string // 方法所需的资源
+	public    map[string]bool     // 无需认证的方法
+	logger    auth.Logger         // 服务端日志记录器
+}
+
+// 认证并鉴权，返回携带消费者的上下文
+func (slf *interceptor) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if slf.public[fullMethod] {
+		return ctx, nil
+	}
+	token := slf.token(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization token is missing")
+	}
+	consumer, err := slf.auth.GetConsumerWithTokenContext(ctx, token)
+	if err != nil {
+		return nil, slf.statusError(fullMethod, err)
+	}
+	resources, exist := slf.resources[fullMethod]
+	if !exist {
+		resources = []string{fullMethod}
+	}
+	var missing []string
+	for _, resource := range resources {
+		if !consumer.ResourceExist(resource) {
+			missing = append(missing, resource)
+		}
+	}
+	if len(missing) > 0 {
+		slf.logger.Debug("missing resource permission", "method", fullMethod, "consumer", consumer.GetTag(), "resources", strings.Join(missing, ", "))
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return NewContext(ctx, consumer), nil
+}
+
+// 从元数据中读取令牌
+func (slf *interceptor) token(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get(slf.key) {
+		value = strings.TrimSpace(value)
+		if slf.scheme == "" {
+			return value
+		}
+		if len(value) > len(slf.scheme) && strings.EqualFold(value[:len(slf.scheme)], slf.scheme) && value[len(slf.scheme)] == ' ' {
+			return strings.TrimSpace(value[len(slf.scheme)+1:])
+		}
+	}
+	return ""
+}
+
+// 将令牌写入待发送的元数据
+func (slf *interceptor) attach(ctx context.Context, source TokenSource) (context.Context, error) {
+	token, err := source(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if slf.scheme != "" {
+		token = slf.scheme + " " + token
+	}
+	return metadata.AppendToOutgoingContext(ctx, slf.key, token), nil
+}
+
+// 将认证错误转换为仅包含固定信息的gRPC状态，错误原因仅在服务端输出，避免向调用方泄露内部信息
+func (slf *interceptor) statusError(fullMethod string, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "canceled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, auth.ErrForbidden):
+		slf.logger.Debug("authenticate failed", "method", fullMethod, "error", err)
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case errors.Is(err, auth.ErrStore):
+		slf.logger.Error("authenticate failed", "method", fullMethod, "error", err)
+		return status.Error(codes.Unavailable, "unavailable")
+	default:
+		slf.logger.Debug("authenticate failed", "method", fullMethod, "error", err)
+		return status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+}
+
+// 替换上下文的服务端流
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (slf *serverStream) Context() context.Context {
+	return slf.ctx
+}
@@ -0,0 +1,132 @@
+package authgrpc
+
+import (
+	"context"
+	"github.com/kercylan98/go-auth/auth"
+	"github.com/kercylan98/go-session/session"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync"
+	"testing"
+)
+
+// 记录日志的日志记录器
+type recordLogger struct {
+	sync.Mutex
+	messages []string
+}
+
+func (slf *recordLogger) record(msg string) {
+	slf.Lock()
+	slf.messages = append(slf.messages, msg)
+	slf.Unlock()
+}
+
+func (slf *recordLogger) Debug(msg string, args ...interface{}) { slf.record(msg) }
+
+func (slf *recordLogger) Info(msg string, args ...interface{}) { slf.record(msg) }
+
+func (slf *recordLogger) Warn(msg string, args ...interface{}) { slf.record(msg) }
+
+func (slf *recordLogger) Error(msg string, args ...interface{}) { slf.record(msg) }
+
+func (slf *recordLogger) count() int {
+	slf.Lock()
+	defer slf.Unlock()
+	return len(slf.messages)
+}
+
+func TestInterceptor(t *testing.T) {
+	a, err := auth.New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetRoleCheck(func(username string, roleHelper *auth.RoleHelper) ([]auth.Role, error) {
+		return []auth.Role{
+			roleHelper.NewRole("monitor").
+				AddResourceGroup(roleHelper.NewResourceGroup("health").
+					Add(roleHelper.NewResource("check", "grpc:health.check"))),
+		}, nil
+	})
+	a.AddTempAccount("admin", "12345")
+	consumer, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := new(recordLogger)
+	options := []Option{WithMethodResources(map[string][]string{
+		"/grpc.health.v1.Health/Check": {"grpc:health.check"},
+	}), WithLogger(logger)}
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(a, options...)),
+		grpc.StreamInterceptor(StreamServerInterceptor(a, options...)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	dial := func(opts ...grpc.DialOption) healthpb.HealthClient {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		conn, err := grpc.Dial("bufnet", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return healthpb.NewHealthClient(conn)
+	}
+	anonymous := dial()
+	client := dial(
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(StaticToken(token))),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(StaticToken(token))),
+	)
+	invalid := dial(grpc.WithUnaryInterceptor(UnaryClientInterceptor(StaticToken("invalid"))))
+
+	ctx := context.Background()
+	if _, err = client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = anonymous.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatal("expect unauthenticated, got", err)
+	}
+	if _, err = invalid.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatal("expect unauthenticated, got", err)
+	}
+
+	// 调用方仅能获得固定的错误信息，原因在服务端输出
+	if message := status.Convert(err).Message(); message != "unauthenticated" {
+		t.Fatal("expect fixed message, got", message)
+	}
+	if logger.count() == 0 {
+		t.Fatal("expect the cause to be logged on the server")
+	}
+
+	// 未配置的方法默认要求与完整方法名相同的资源
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.PermissionDenied || status.Convert(err).Message() != "permission denied" {
+		t.Fatal("expect permission denied, got", err)
+	}
+}
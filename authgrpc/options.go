@@ -0,0 +1,57 @@
+package authgrpc
+
+import (
+	"github.com/kercylan98/go-auth/auth"
+)
+
+// Option 拦截器的可选配置
+type Option func(i *interceptor)
+
+// WithMetadataKey 从特定的元数据键读取（或写入）令牌，scheme 不为空时值需以 scheme 加空格开头（不区分大小写），默认 authorization 及 Bearer
+func WithMetadataKey(key string, scheme string) Option {
+	return func(i *interceptor) {
+		i.key = key
+		i.scheme = scheme
+	}
+}
+
+// WithMethodResources 设置完整方法名（如 /pkg.Service/Method）所需的资源，值为空切片时仅要求登录
+//
+// 未设置的方法默认要求消费者拥有与完整方法名相同的资源
+func WithMethodResources(resources map[string][]string) Option {
+	return func(i *interceptor) {
+		for method, uris := range resources {
+			i.resources[method] = uris
+		}
+	}
+}
+
+// WithPublicMethods 设置无需认证的完整方法名，如健康检查
+func WithPublicMethods(methods ...string) Option {
+	return func(i *interceptor) {
+		for _, method := range methods {
+			i.public[method] = true
+		}
+	}
+}
+
+// WithLogger 使用特定的日志记录器输出认证失败的原因，默认使用 slog.Default()，传入 nil 时不输出任何日志
+func WithLogger(logger auth.Logger) Option {
+	return func(i *interceptor) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		i.logger = logger
+	}
+}
+
+// 不输出任何日志的日志记录器
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+
+func (nopLogger) Info(msg string, args ...interface{}) {}
+
+func (nopLogger) Warn(msg string, args ...interface{}) {}
+
+func (nopLogger) Error(msg string, args ...interface{}) {}
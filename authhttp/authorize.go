@@ -0,0 +1,115 @@
+package authhttp
+
+import (
+	"github.com/kercylan98/go-auth/auth"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ForbiddenError 消费者缺少资源权限时的错误，可通过 errors.Is(err, auth.ErrForbidden) 判断
+type ForbiddenError struct {
+	Missing []string // 缺少的资源
+}
+
+func (slf *ForbiddenError) Error() string {
+	return "missing resource permission: " + strings.Join(slf.Missing, ", ")
+}
+
+// Is 使其可通过 errors.Is(err, auth.ErrForbidden) 判断
+func (slf *ForbiddenError) Is(target error) bool {
+	return target == auth.ErrForbidden
+}
+
+// Authorize 创建路由鉴权中间件，需在 Authenticate 之后使用
+//
+// 请求对应的资源为 小写请求方法:规范化后的路径，如 post:/api/user，路径匹配 WithRoutes 设置的模板时使用模板，如 get:/api/user/{id}。
+// 路径中的重复斜杠、. 及 .. 段和末尾斜杠将被规范化，避免绕过拒绝资源。
+// 每条资源通过 auth.Consumer.Decide 分别作出决策（拒绝资源优先并受授权范围限制），
+// 消费者需同时被允许访问该资源及 WithResources 设置的额外资源，否则响应 403 及 *ForbiddenError
+func Authorize(options ...Option) func(http.Handler) http.Handler {
+	m := newMiddleware(nil, options...)
+	return m.authorize
+}
+
+// ResourceURI 获取请求对应的资源，路径匹配模板（如 /api/user/{id}）时使用模板作为资源路径
+func ResourceURI(r *http.Request, templates ...string) string {
+	routes := make([][]string, 0, len(templates))
+	for _, template := range templates {
+		routes = append(routes, splitPath(template))
+	}
+	return resourceURI(r, routes)
+}
+
+// Check 检查请求上下文中的消费者是否被允许访问特定资源，可在处理器中追加所需的资源
+//
+// 每条资源通过 auth.Consumer.Decide 分别作出决策，未登录时返回 auth.ErrNotLoggedIn，缺少资源或命中拒绝资源时返回 *ForbiddenError
+func Check(r *http.Request, resources ...string) error {
+	consumer, ok := ConsumerFromContext(r.Context())
+	if !ok {
+		return auth.ErrNotLoggedIn
+	}
+	var missing []string
+	for _, resource := range resources {
+		if !consumer.Decide(resource).Allowed {
+			missing = append(missing, resource)
+		}
+	}
+	if len(missing) > 0 {
+		return &ForbiddenError{Missing: missing}
+	}
+	return nil
+}
+
+func (slf *middleware) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resources := append([]string{resourceURI(r, slf.routes)}, slf.resources...)
+		if err := Check(r, resources...); err != nil {
+			slf.render(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 获取请求对应的资源
+func resourceURI(r *http.Request, routes [][]string) string {
+	uri := cleanPath(r.URL.Path)
+	segments := splitPath(uri)
+	for _, route := range routes {
+		if matchRoute(route, segments) {
+			uri = "/" + strings.Join(route, "/")
+			break
+		}
+	}
+	return strings.ToLower(r.Method) + ":" + uri
+}
+
+// 规范化请求路径，合并重复斜杠并解析 . 及 .. 段，除根路径外不保留末尾斜杠
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// 检查路径段是否匹配路由模板
+func matchRoute(route []string, segments []string) bool {
+	if len(route) != len(segments) {
+		return false
+	}
+	for i, segment := range route {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 拆分路径段
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
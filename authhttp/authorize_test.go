@@ -0,0 +1,86 @@
+package authhttp
+
+import (
+	"github.com/kercylan98/go-auth/auth"
+	"github.com/kercylan98/go-session/session"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	a, err := auth.New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetRoleCheck(func(username string, roleHelper *auth.RoleHelper) ([]auth.Role, error) {
+		return []auth.Role{
+			roleHelper.NewRole("user-admin").
+				AddResourceGroup(roleHelper.NewResourceGroup("user").
+					Add(roleHelper.NewResource("get user", "get:/api/user/{id}")).
+					Add(roleHelper.NewResource("create user", "post:/api/user"))),
+			roleHelper.NewRole("reader").
+				AddResourceGroup(roleHelper.NewResourceGroup("docs").
+					Add(roleHelper.NewResource("read docs", "get:/docs/**")).
+					Add(roleHelper.NewDenyResource("internal docs", "get:/docs/internal/**"))),
+		}, nil
+	})
+	a.AddTempAccount("admin", "12345")
+	consumer, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	authenticate := Authenticate(a)
+	routes := authenticate(Authorize(WithRoutes("/api/user/{id}"))(ok))
+	docs := authenticate(Authorize()(ok))
+	audit := authenticate(Authorize(WithRoutes("/api/user/{id}"), WithResources("get:/api/audit"))(ok))
+	inHandler := authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Check(r, "post:/api/user"); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+
+	for _, c := range []struct {
+		handler http.Handler
+		method  string
+		path    string
+		status  int
+	}{
+		{routes, http.MethodGet, "/api/user/42", http.StatusOK},
+		{routes, http.MethodPost, "/api/user", http.StatusOK},
+		{routes, http.MethodDelete, "/api/user/42", http.StatusForbidden},
+		{routes, http.MethodGet, "/api/user/42/detail", http.StatusForbidden},
+		{audit, http.MethodGet, "/api/user/42", http.StatusForbidden},
+		{inHandler, http.MethodGet, "/", http.StatusOK},
+		{docs, http.MethodGet, "/docs/guide", http.StatusOK},
+		// 非规范路径不能绕过拒绝资源
+		{docs, http.MethodGet, "/docs/internal/plan", http.StatusForbidden},
+		{docs, http.MethodGet, "/docs//internal/plan", http.StatusForbidden},
+		{docs, http.MethodGet, "/docs/./internal/plan", http.StatusForbidden},
+		{docs, http.MethodGet, "/docs/guide/../internal/plan", http.StatusForbidden},
+		{docs, http.MethodGet, "/docs/internal/plan/", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		c.handler.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Fatalf("%s %s: expect status %d, got %d", c.method, c.path, c.status, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/42", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	audit.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "get:/api/audit") || strings.Contains(w.Body.String(), "get:/api/user/{id}") {
+		t.Fatal("response should contain only the missing resource, got", w.Body.String())
+	}
+}
@@ -0,0 +1,134 @@
+package authhttp
+
+import (
+	"context"
+	"errors"
+	"github.com/kercylan98/go-auth/auth"
+	"net/http"
+	"strings"
+)
+
+// ErrMissingToken 请求中未携带令牌
+var ErrMissingToken = errors.New("authorization token is missing")
+
+// 消费者在请求上下文中的键
+type consumerKey struct{}
+
+// NewContext 返回携带消费者的上下文
+func NewContext(ctx context.Context, consumer auth.Consumer) context.Context {
+	return context.WithValue(ctx, consumerKey{}, consumer)
+}
+
+// ConsumerFromContext 获取认证中间件写入请求上下文的消费者
+func ConsumerFromContext(ctx context.Context) (auth.Consumer, bool) {
+	consumer, ok := ctx.Value(consumerKey{}).(auth.Consumer)
+	return consumer, ok
+}
+
+// Authenticate 创建认证中间件
+//
+// 中间件依次从请求头、Cookie及查询参数中读取令牌，通过 Auth 获取消费者后写入请求上下文，可通过 ConsumerFromContext 获取。
+// 未携带令牌或令牌无效时响应 401，消费者缺少权限时响应 403，会话管理器不可用时响应 503
+func Authenticate(a auth.Auth, options ...Option) func(http.Handler) http.Handler {
+	m := newMiddleware(a, options...)
+	return m.authenticate
+}
+
+// DefaultErrorRenderer 默认的错误渲染器，输出状态码对应的文本，401 时附带 WWW-Authenticate 响应头，403 时附带缺少的资源
+func DefaultErrorRenderer(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		http.Error(w, http.StatusText(status)+": "+forbidden.Error(), status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func newMiddleware(a auth.Auth, options ...Option) *middleware {
+	m := &middleware{
+		auth:     a,
+		header:   "Authorization",
+		scheme:   "Bearer",
+		renderer: DefaultErrorRenderer,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+type middleware struct {
+	auth     auth.Auth
+	header   string        // 读取令牌的请求头
+	scheme   string        // 请求头中令牌的前缀
+	cookie   string        // 读取令牌的Cookie名称
+	query    string        // 读取令牌的查询参数名称
+	optional bool          // 未携带令牌时是否放行
+	renderer ErrorRenderer // 错误渲染器
+
+	routes    [][]string // 已拆分路径段的路由模板
+	resources []string   // 额外要求的资源
+}
+
+func (slf *middleware) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := slf.token(r)
+		if token == "" {
+			if slf.optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			slf.render(w, r, ErrMissingToken)
+			return
+		}
+		consumer, err := slf.auth.GetConsumerWithTokenContext(r.Context(), token)
+		if err != nil {
+			slf.render(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), consumer)))
+	})
+}
+
+// 从请求中读取令牌
+func (slf *middleware) token(r *http.Request) string {
+	if slf.header != "" {
+		if value := strings.TrimSpace(r.Header.Get(slf.header)); value != "" {
+			if slf.scheme == "" {
+				return value
+			}
+			if len(value) > len(slf.scheme) && strings.EqualFold(value[:len(slf.scheme)], slf.scheme) && value[len(slf.scheme)] == ' ' {
+				return strings.TrimSpace(value[len(slf.scheme)+1:])
+			}
+		}
+	}
+	if slf.cookie != "" {
+		if cookie, err := r.Cookie(slf.cookie); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	if slf.query != "" {
+		return r.URL.Query().Get(slf.query)
+	}
+	return ""
+}
+
+// 根据错误类型渲染响应
+func (slf *middleware) render(w http.ResponseWriter, r *http.Request, err error) {
+	slf.renderer(w, r, statusOf(err), err)
+}
+
+// 错误对应的状态码
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrStore):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusUnauthorized
+	}
+}
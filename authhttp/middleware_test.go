@@ -0,0 +1,89 @@
+package authhttp
+
+import (
+	"errors"
+	"github.com/kercylan98/go-auth/auth"
+	"github.com/kercylan98/go-session/session"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestAuth(t *testing.T) (auth.Auth, string) {
+	a, err := auth.New(session.NewManagerMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AddTempAccount("admin", "12345")
+	consumer, err := a.Login().Password("admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := consumer.GetToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, token
+}
+
+// 返回消费者用户名的处理器
+var usernameHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	consumer, ok := ConsumerFromContext(r.Context())
+	if !ok {
+		_, _ = w.Write([]byte("anonymous"))
+		return
+	}
+	_, _ = w.Write([]byte(consumer.GetUsername()))
+})
+
+func TestAuthenticate(t *testing.T) {
+	a, token := newTestAuth(t)
+	handler := Authenticate(a, WithCookie("token"), WithQuery("access_token"))(usernameHandler)
+
+	for _, c := range []struct {
+		name   string
+		modify func(r *http.Request)
+		status int
+	}{
+		{"header", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, http.StatusOK},
+		{"lowercase scheme", func(r *http.Request) { r.Header.Set("Authorization", "bearer "+token) }, http.StatusOK},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: token}) }, http.StatusOK},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "access_token=" + token }, http.StatusOK},
+		{"missing", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"invalid", func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid") }, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		c.modify(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Fatalf("%s: expect status %d, got %d", c.name, c.status, w.Code)
+		}
+		if c.status == http.StatusOK && w.Body.String() != "admin" {
+			t.Fatalf("%s: unexpected consumer %s", c.name, w.Body.String())
+		}
+	}
+}
+
+func TestAuthenticate_Optional(t *testing.T) {
+	a, _ := newTestAuth(t)
+	var rendered error
+	handler := Authenticate(a, WithOptional(), WithErrorRenderer(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		rendered = err
+		w.WriteHeader(status)
+	}))(usernameHandler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "anonymous" {
+		t.Fatal("request without token should pass through")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer invalid")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || !errors.Is(rendered, auth.ErrInvalidToken) {
+		t.Fatal("invalid token should be rendered, got", w.Code, rendered)
+	}
+}
@@ -0,0 +1,63 @@
+package authhttp
+
+import (
+	"net/http"
+)
+
+// Option 中间件的可选配置
+type Option func(m *middleware)
+
+// ErrorRenderer 错误渲染器，status 为 http.StatusUnauthorized、http.StatusForbidden 等状态码
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// WithHeader 从特定的请求头读取令牌，scheme 不为空时请求头的值需以 scheme 加空格开头（不区分大小写），默认 Authorization 及 Bearer
+func WithHeader(name string, scheme string) Option {
+	return func(m *middleware) {
+		m.header = name
+		m.scheme = scheme
+	}
+}
+
+// WithCookie 请求头中不存在令牌时，从特定名称的Cookie读取令牌
+func WithCookie(name string) Option {
+	return func(m *middleware) {
+		m.cookie = name
+	}
+}
+
+// WithQuery 请求头及Cookie中不存在令牌时，从特定名称的查询参数读取令牌
+func WithQuery(name string) Option {
+	return func(m *middleware) {
+		m.query = name
+	}
+}
+
+// WithOptional 未携带令牌的请求将直接放行且不会写入消费者，携带无效令牌时仍将返回错误
+func WithOptional() Option {
+	return func(m *middleware) {
+		m.optional = true
+	}
+}
+
+// WithErrorRenderer 使用特定的错误渲染器，默认输出状态码对应的文本
+func WithErrorRenderer(renderer ErrorRenderer) Option {
+	return func(m *middleware) {
+		m.renderer = renderer
+	}
+}
+
+// WithRoutes 设置路由模板（如 /api/user/{id}），鉴权时请求路径将按顺序匹配模板，匹配成功时以模板作为资源路径，{name} 匹配单个非空路径段
+func WithRoutes(templates ...string) Option {
+	return func(m *middleware) {
+		for _, template := range templates {
+			m.routes = append(m.routes, splitPath(template))
+		}
+	}
+}
+
+// WithResources 鉴权时除请求对应的资源外，还要求消费者拥有的额外资源
+func WithResources(resources ...string) Option {
+	return func(m *middleware) {
+		m.resources = append(m.resources, resources...)
+	}
+}
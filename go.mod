@@ -1,10 +1,25 @@
 module github.com/kercylan98/go-auth
 
-go 1.17
+go 1.21
 
 require (
+	github.com/go-asn1-ber/asn1-ber v1.5.5
+	github.com/go-ldap/ldap/v3 v3.4.8
+	github.com/kercylan98/go-session v0.0.0-20211117025047-4ba6224cf4f3
+	github.com/satori/go.uuid v1.2.0
+	golang.org/x/crypto v0.21.0
+	google.golang.org/grpc v1.56.3
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/go-redis/redis v6.15.9+incompatible // indirect
-	github.com/kercylan98/go-session v0.0.0-20211117025047-4ba6224cf4f3 // indirect
-	github.com/kercylan98/klib v1.0.1-beta // indirect
-	github.com/satori/go.uuid v1.2.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 )